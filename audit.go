@@ -2,7 +2,6 @@ package todo
 
 import (
 	"fmt"
-	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -11,7 +10,7 @@ import (
 const AUDIT_LOG = "audit_log/"
 const AUDIT_MINIMUM_FIELDS = 6 // XXX don't need "Notes"
 const AUDIT_FIELDS = "BodyContent, DueDate, Repeat, OverdueDays," +
-	"Category, DateCompleted, Notes" +
+	"Category, DateCompleted, Notes, Dropped, Tags" +
 	"\n"
 
 type Records []Record
@@ -33,7 +32,7 @@ func (records Records) Swap(i, j int) {
 type Record struct {
 	BodyContent string
 	DueDate     time.Time
-	Repeat      *string
+	Repeat      *Recurrence
 	OverdueDays int
 	// This is actually determined at load time again,
 	// since audit logs store the category by virtue of being in
@@ -41,20 +40,28 @@ type Record struct {
 	Category      string
 	DateCompleted time.Time
 	Annotation    string
+	// Whether the task was dropped rather than done, see PURGE_DROP. The
+	// annotation says why.
+	Dropped bool
+	Tags    []string
 }
 
 func (record Record) Marshal() []string {
 	bodyContent := record.BodyContent
-	dueDate := record.DueDate.Format(EXPLICIT_TIME_FORMAT)
+	dueDate := formatRecordDate(record.DueDate, RECORD_DATE_FORMAT)
 	repeat := ""
 	if record.Repeat != nil {
-		repeat = *record.Repeat
+		repeat = record.Repeat.RRULE()
 	}
 	overdueDays := strconv.Itoa(record.OverdueDays)
 	// Category determined at load time, from directory of audit_log
 	category := ""
-	dateCompleted := record.DateCompleted.Format(RECORD_TIME_FORMAT)
+	dateCompleted := formatRecordDate(record.DateCompleted, RECORD_DATE_TIME_FORMAT)
 	annotation := record.Annotation
+	dropped := ""
+	if record.Dropped {
+		dropped = strconv.FormatBool(record.Dropped)
+	}
 	return []string{
 		bodyContent,
 		dueDate,
@@ -63,6 +70,8 @@ func (record Record) Marshal() []string {
 		category,
 		dateCompleted,
 		annotation,
+		dropped,
+		strings.Join(record.Tags, " "),
 	}
 }
 
@@ -71,9 +80,9 @@ func (record Record) String() string {
 	overdue := ""
 	dateDue := record.DueDate.AddDate(0, 0, record.OverdueDays)
 	if dateDue.Before(record.DateCompleted) {
-		overdueDays := int(math.Floor(record.DateCompleted.Sub(dateDue).Hours() / 24))
+		overdueDays := daysBetween(dateDue, record.DateCompleted)
 		if overdueDays != 0 {
-			overdue = fmt.Sprintf(RED+" (overdue %d days)"+RESET, overdueDays)
+			overdue = colorize(currentDisplay().Theme.Overdue, fmt.Sprintf(" (overdue %d days)", overdueDays))
 		}
 	}
 
@@ -83,12 +92,18 @@ func (record Record) String() string {
 	}
 
 	trimmedContent := strings.TrimSuffix(record.BodyContent, "\n")
-	postamble := fmt.Sprintf("%-15s%s", categoryName, overdue)
-	audit_entry := HardWrapString(trimmedContent, 60,
+	for _, tag := range withoutTags(record.Tags, bodyTags(record.BodyContent)) {
+		trimmedContent += " " + TAG_PREFIX + tag
+	}
+	if record.Dropped {
+		overdue += colorize(currentDisplay().Theme.Greyed, " (dropped)")
+	}
+	postamble := padRight(categoryName, 15) + overdue
+	audit_entry := HardWrapString(trimmedContent, bodyLength(),
 		completed, len(completed)+2, postamble, " ")
 	if record.Annotation != "" {
-		if len(record.Annotation) >= 60 {
-			audit_entry += HardWrapString(record.Annotation, 60,
+		if displayWidth(record.Annotation) >= bodyLength() {
+			audit_entry += HardWrapString(record.Annotation, bodyLength(),
 				"\n                         ┃  ", len(completed)+5, " ", "┃  ")
 		} else {
 			audit_entry += "\n                         ┗━ " + record.Annotation
@@ -97,24 +112,33 @@ func (record Record) String() string {
 	return audit_entry
 }
 
-func Unmarshal(fields []string) Record {
+func Unmarshal(fields []string) (Record, error) {
 	if len(fields) < AUDIT_MINIMUM_FIELDS {
-		panic(fmt.Sprintf("actual %d != expected at least %d", len(fields), AUDIT_MINIMUM_FIELDS))
+		return Record{}, fmt.Errorf("actual %d != expected at least %d fields",
+			len(fields), AUDIT_MINIMUM_FIELDS)
 	}
 	var record Record
 	record.BodyContent = fields[0]
-	record.DueDate, _ = time.Parse(EXPLICIT_TIME_FORMAT, fields[1])
+	record.DueDate, _ = parseRecordDate(fields[1], RECORD_DATE_FORMAT, EXPLICIT_TIME_FORMAT)
 	if fields[2] != "" {
-		record.Repeat = &fields[2]
+		// Older logs have repeats as they used to be written, which still
+		// parse. Anything else is not worth losing the record over.
+		record.Repeat, _ = ParseRecurrence(fields[2])
 	}
 	overdueDays, _ := strconv.ParseInt(fields[3], 10, 32)
 	record.OverdueDays = int(overdueDays)
 	record.Category = fields[4]
-	record.DateCompleted, _ = time.Parse(RECORD_TIME_FORMAT, fields[5])
+	record.DateCompleted, _ = parseRecordDate(fields[5], RECORD_DATE_TIME_FORMAT, RECORD_TIME_FORMAT)
 
 	if len(fields) >= 7 {
 		record.Annotation = fields[6]
 	}
+	if len(fields) >= 8 {
+		record.Dropped, _ = strconv.ParseBool(fields[7])
+	}
+	if len(fields) >= 9 {
+		record.Tags = strings.Fields(fields[8])
+	}
 
-	return record
+	return record, nil
 }
@@ -1,14 +1,36 @@
 package todo
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Categories can be nested, e.g. "work/clientA" is in "work".
+const CATEGORY_SEPARATOR = "/"
+
+// Archived categories are nested in this one, which is left out of
+// listings unless it's asked for.
+const ARCHIVE_CATEGORY = ".archive"
 
 type Category struct {
-	Name  string
+	// The full path of the category, e.g. "work/clientA"
+	Name string
+	// Tasks due in this category and every category nested in it
 	Tasks int
 }
 
 func (category Category) String() string {
-	return fmt.Sprintf("%-20s %d tasks", category.Name, category.Tasks)
+	depth := category.Depth()
+	indent := strings.Repeat("  ", depth)
+	return fmt.Sprintf("%s%-*s %d tasks", indent, 20-len(indent),
+		path.Base(category.Name), category.Tasks)
+}
+
+// How deeply the category is nested, top level categories being 0.
+func (category Category) Depth() int {
+	return strings.Count(category.Name, CATEGORY_SEPARATOR)
 }
 
 type Categories []Category
@@ -17,10 +39,60 @@ func (categories Categories) Len() int {
 	return len(categories)
 }
 
+// Sorts categories as a tree, each category followed by those nested in it.
 func (categories Categories) Less(i, j int) bool {
-	return categories[i].Tasks < categories[j].Tasks
+	a := strings.Split(categories[i].Name, CATEGORY_SEPARATOR)
+	b := strings.Split(categories[j].Name, CATEGORY_SEPARATOR)
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
 }
 
 func (categories Categories) Swap(i, j int) {
 	categories[i], categories[j] = categories[j], categories[i]
 }
+
+// Checks a category path, returning it without any leading or trailing
+// separators. The empty string is no category.
+func CleanCategory(category string) (string, error) {
+	category = strings.Trim(category, CATEGORY_SEPARATOR)
+	if category == "" {
+		return "", nil
+	}
+	for _, part := range strings.Split(category, CATEGORY_SEPARATOR) {
+		if part == "" || part == "." || part == ".." {
+			return "", errors.New(fmt.Sprintf("Bad category \"%s\"", category))
+		}
+	}
+	return category, nil
+}
+
+// Every category the category is nested in, outermost first.
+func parentCategories(category string) []string {
+	var parents []string
+	for i, c := range category {
+		if string(c) == CATEGORY_SEPARATOR {
+			parents = append(parents, category[:i])
+		}
+	}
+	return parents
+}
+
+// The category a category ends up as when from is moved to to.
+func movedCategory(category, from, to string) string {
+	return to + strings.TrimPrefix(category, from)
+}
+
+// Determines if a category is archived.
+func archived(category string) bool {
+	return inCategory(category, ARCHIVE_CATEGORY)
+}
+
+// Determines if a category is the other category, or nested in it.
+func inCategory(category, other string) bool {
+	return other == "" || category == other ||
+		strings.HasPrefix(category, other+CATEGORY_SEPARATOR)
+}
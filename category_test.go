@@ -0,0 +1,160 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCleanCategory(t *testing.T) {
+	tests := []struct {
+		category, want string
+	}{
+		{"", ""},
+		{"work", "work"},
+		{"/work/clientA/", "work/clientA"},
+	}
+	for _, test := range tests {
+		if got, err := CleanCategory(test.category); err != nil || got != test.want {
+			t.Errorf("CleanCategory(%q) = %q, %v, want %q", test.category, got, err, test.want)
+		}
+	}
+	for _, category := range []string{"work//clientA", "work/../home", "./work"} {
+		if got, err := CleanCategory(category); err == nil {
+			t.Errorf("CleanCategory(%q) = %q, want an error", category, got)
+		}
+	}
+}
+
+// A manager for the category, sharing the store.
+func inTestCategory(taskManager *TaskManager, category string) *TaskManager {
+	return &TaskManager{Store: taskManager.Store, Clock: taskManager.Clock, Category: category}
+}
+
+func TestNestedCategories(t *testing.T) {
+	taskManager, _ := testManagers()
+	for _, category := range []string{"home/repairs/plumbing", "homework", ARCHIVE_CATEGORY + "/home"} {
+		if err := taskManager.CreateCategory(category); err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestTask(t, inTestCategory(taskManager, "home"), "file taxes")
+	createTestTask(t, inTestCategory(taskManager, "home/repairs/plumbing"), "fix sink")
+	createTestTask(t, inTestCategory(taskManager, "homework"), "essay")
+	createTestTask(t, inTestCategory(taskManager, ARCHIVE_CATEGORY+"/home"), "old chore")
+
+	// Creating a category creates the ones it's nested in, each counting
+	// the tasks nested in it
+	categories, err := taskManager.GetCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, category := range categories {
+		got = append(got, fmt.Sprintf("%s:%d", category.Name, category.Tasks))
+	}
+	want := []string{"home:2", "home/repairs:1", "home/repairs/plumbing:1", "homework:1"}
+	if !equalStrings(got, want) {
+		t.Errorf("GetCategories() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		category string
+		want     []string
+	}{
+		{"", []string{"home/repairs/plumbing:fix sink", "home:file taxes", "homework:essay"}},
+		// Not "homework", which only starts the same
+		{"home", []string{"home/repairs/plumbing:fix sink", "home:file taxes"}},
+		{"home/repairs", []string{"home/repairs/plumbing:fix sink"}},
+		// Archived tasks are only listed in the archive
+		{ARCHIVE_CATEGORY, []string{".archive/home:old chore"}},
+	}
+	for _, test := range tests {
+		tasks, err := inTestCategory(taskManager, test.category).GetTasks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := taskBodies(tasks); !equalStrings(got, test.want) {
+			t.Errorf("listing %q got %v, want %v", test.category, got, test.want)
+		}
+	}
+}
+
+func TestManageCategories(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			taskManager := &TaskManager{Store: store, Clock: testClock}
+			for _, category := range []string{"work/clientA", "home"} {
+				if err := taskManager.CreateCategory(category); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bob := createTestTask(t, inTestCategory(taskManager, "work"), "call bob")
+			createTestTask(t, inTestCategory(taskManager, "work/clientA"), "send invoice")
+			createTestTask(t, inTestCategory(taskManager, "home"), "call bob")
+			if err := taskManager.AuditLog(bob, testClock.Now(), ""); err != nil {
+				t.Fatal(err)
+			}
+			expect := func(what string, want ...string) {
+				t.Helper()
+				if got := storedBodies(t, taskManager); !equalStrings(got, want) {
+					t.Errorf("%s, stored %v, want %v", what, got, want)
+				}
+			}
+
+			if err := taskManager.RenameCategory("work", "home"); !errors.Is(err, ErrCategoryExists) {
+				t.Errorf("renaming onto home: got %v, want %v", err, ErrCategoryExists)
+			}
+			if err := taskManager.RenameCategory("work", "work/old"); err == nil {
+				t.Error("renaming into itself should fail")
+			}
+			if err := taskManager.MergeCategory("work", "job"); !errors.Is(err, ErrCategoryNotFound) {
+				t.Errorf("merging into job: got %v, want %v", err, ErrCategoryNotFound)
+			}
+
+			if err := taskManager.RenameCategory("work", "job"); err != nil {
+				t.Fatal(err)
+			}
+			expect("after renaming", "home:call bob", "job/clientA:send invoice", "job:call bob")
+			records, err := taskManager.AuditRecords()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || records[0].Category != "job" {
+				t.Errorf("after renaming, audit log %v, want the record in job", records)
+			}
+
+			// Either everything moves or nothing does
+			if err := taskManager.MergeCategory("job", "home"); !errors.Is(err, ErrTaskExists) {
+				t.Errorf("merging job into home: got %v, want %v", err, ErrTaskExists)
+			}
+			expect("after failing to merge", "home:call bob", "job/clientA:send invoice", "job:call bob")
+			if err := taskManager.MergeCategory("job/clientA", "home"); err != nil {
+				t.Fatal(err)
+			}
+			expect("after merging", "home:call bob", "home:send invoice", "job:call bob")
+
+			if err := taskManager.DeleteCategory("job", false); !errors.Is(err, ErrCategoryNotEmpty) {
+				t.Errorf("deleting job: got %v, want %v", err, ErrCategoryNotEmpty)
+			}
+			if err := taskManager.DeleteCategory("job", true); err != nil {
+				t.Fatal(err)
+			}
+			expect("after deleting", "home:call bob", "home:send invoice")
+			if records, err := taskManager.AuditRecords(); err != nil || len(records) != 0 {
+				t.Errorf("after deleting, audit log %v, %v, want nothing", records, err)
+			}
+
+			if err := taskManager.ArchiveCategory("home"); err != nil {
+				t.Fatal(err)
+			}
+			expect("after archiving", ".archive/home:call bob", ".archive/home:send invoice")
+			if tasks, err := taskManager.GetTasks(); err != nil || len(tasks) != 0 {
+				t.Errorf("after archiving, listed %v, %v, want nothing", taskBodies(tasks), err)
+			}
+			if err := taskManager.ArchiveCategory(".archive/home"); err == nil {
+				t.Error("archiving an archived category should fail")
+			}
+		})
+	}
+}
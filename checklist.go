@@ -0,0 +1,186 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Separates a task's index from an item's number, e.g. "3f.2" is the
+// second item of task 3f.
+const ITEM_SEPARATOR = "."
+
+// A step in a task's checklist.
+type ChecklistItem struct {
+	Body string
+	Done bool `json:",omitempty"`
+}
+
+// Reads a reference to a checklist item, e.g. "3f.2", into the task's
+// index and the item's number, counting from 1.
+func ParseItemRef(ref string) (string, int, error) {
+	i := strings.LastIndex(ref, ITEM_SEPARATOR)
+	if i <= 0 {
+		return "", 0, errors.New(fmt.Sprintf("Bad checklist item \"%s\", need e.g. \"3f%s2\"",
+			ref, ITEM_SEPARATOR))
+	}
+	number, err := strconv.Atoi(ref[i+len(ITEM_SEPARATOR):])
+	if err != nil || number < 1 {
+		return "", 0, errors.New(fmt.Sprintf("Bad checklist item \"%s\", need e.g. \"3f%s2\"",
+			ref, ITEM_SEPARATOR))
+	}
+	return ref[:i], number, nil
+}
+
+// Makes checklist items, checking they aren't empty.
+func NewChecklist(bodies []string) ([]ChecklistItem, error) {
+	var items []ChecklistItem
+	for _, body := range bodies {
+		body = strings.TrimSpace(body)
+		if body == "" {
+			return nil, errors.New("Cannot make a checklist item with an empty string")
+		}
+		items = append(items, ChecklistItem{Body: body})
+	}
+	return items, nil
+}
+
+// How many items are done, and how many there are.
+func (task Task) checklistDone() (done int, total int) {
+	for _, item := range task.Checklist {
+		if item.Done {
+			done++
+		}
+	}
+	return done, len(task.Checklist)
+}
+
+// Shows how far through its checklist a task is, e.g. " [1/3]".
+func (task Task) checklistMarker() string {
+	done, total := task.checklistDone()
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [%d/%d]", done, total)
+}
+
+// The checklist, one item to a line, indented to line up with the task's
+// body. Done items are greyed out.
+func (task Task) FormatChecklist() string {
+	var lines []string
+	for i, item := range task.Checklist {
+		check := "[ ]"
+		if item.Done {
+			check = "[x]"
+		}
+		line := HardWrapString(item.Body, bodyLength()-4,
+			fmt.Sprintf("%10s%s %d.", "", check, i+1), 10+len(check)+5, "", " ")
+		if item.Done {
+			line = colorize(currentDisplay().Theme.Greyed, line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The task as it is next time around, for a repeating task: due next, with
+// none of its checklist done.
+func (task Task) nextOccurrence(completed time.Time) (Task, error) {
+	next := task
+	var err error
+	next.DueDate, err = task.NextDueDate(completed)
+	if err != nil {
+		return task, err
+	}
+	next.Checklist = make([]ChecklistItem, len(task.Checklist))
+	for i, item := range task.Checklist {
+		next.Checklist[i] = ChecklistItem{Body: item.Body}
+	}
+	return next, nil
+}
+
+// The task's first occurrence that isn't due before today, for a repeating
+// task that's fallen behind.
+func (task Task) upcomingOccurrence(now time.Time) (Task, error) {
+	next := task
+	for next.DueDate.Before(startOfDay(now)) {
+		var err error
+		next, err = next.nextOccurrence(now)
+		if err != nil {
+			return task, err
+		}
+	}
+	return next, nil
+}
+
+// -k, checks off an item in a task's checklist, logging it. Checking off
+// the last item completes the task, which is logged too and, if it
+// repeats, comes around again with its checklist unchecked.
+//
+// Returns the task as it is after, and whether it was completed.
+func (cmdManager *CommandManager) CheckItem(taskManager *TaskManager, ref string) (*Task, bool, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	index, number, err := ParseItemRef(ref)
+	if err != nil {
+		return nil, false, err
+	}
+	allTasks, err := cmdManager.getTasks(taskManager)
+	if err != nil {
+		return nil, false, err
+	}
+	cmdManager.SkipTaskCreationPrompt = true
+	found, err := allTasks.Find(index)
+	if err != nil {
+		return nil, false, err
+	}
+	original := *found
+	if number > len(original.Checklist) {
+		return nil, false, errors.New(fmt.Sprintf("Task \"%s\" has no item %d",
+			strings.TrimSuffix(original.BodyContent, "\n"), number))
+	}
+	item := original.Checklist[number-1]
+	if item.Done {
+		return nil, false, errors.New(fmt.Sprintf("\"%s\" is already done", item.Body))
+	}
+
+	checked := original
+	checked.Checklist = append([]ChecklistItem(nil), original.Checklist...)
+	checked.Checklist[number-1].Done = true
+	itemRecord := NewRecord(original, cmdManager.DueDate, cmdManager.Annotation)
+	itemRecord.BodyContent = fmt.Sprintf("%s: %s",
+		strings.TrimSuffix(original.BodyContent, "\n"), item.Body)
+
+	var tx Transaction
+	done, total := checked.checklistDone()
+	completed := done == total
+	after := checked
+	if !completed {
+		tx = taskManager.ReplaceTask(original, &after)
+	} else if original.Repeat != nil {
+		after, err = checked.nextOccurrence(cmdManager.DueDate)
+		if err != nil {
+			return nil, false, err
+		}
+		tx = taskManager.ReplaceTask(original, &after)
+	} else {
+		tx = Transaction{Delete: Tasks{original}}
+	}
+	tx.Records = append(tx.Records, itemRecord)
+	if completed {
+		tx.Records = append(tx.Records, NewRecord(checked, cmdManager.DueDate, ""))
+	}
+	commit := cmdManager.commitUnchanged
+	if completed {
+		commit = cmdManager.commitDone
+	}
+	if err := commit(taskManager, original, tx); err != nil {
+		return nil, false, err
+	}
+	cmdManager.tasks = nil
+	// Keep showing it by the index it was checked by
+	after.index = original.index
+	return &after, completed, nil
+}
@@ -0,0 +1,92 @@
+package todo
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestParseItemRef(t *testing.T) {
+	index, number, err := ParseItemRef("3f.2")
+	if err != nil || index != "3f" || number != 2 {
+		t.Errorf("ParseItemRef(\"3f.2\") = %q, %d, %v, want \"3f\", 2", index, number, err)
+	}
+	for _, ref := range []string{"3f", ".2", "3f.", "3f.0", "3f.two"} {
+		if _, _, err := ParseItemRef(ref); err == nil {
+			t.Errorf("ParseItemRef(%q) should fail", ref)
+		}
+	}
+}
+
+func TestCheckItem(t *testing.T) {
+	for _, repeats := range []bool{false, true} {
+		taskManager, cmdManager := testManagers()
+		for _, item := range []string{"buy paint", "paint the wall"} {
+			if err := cmdManager.AddItem(item); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if repeats {
+			cmdManager.Repeat = &Recurrence{Frequency: WEEKLY}
+		}
+		task, err := cmdManager.CreateTask(taskManager, "decorate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		check := func(n string) (*Task, bool, error) {
+			_, cmdManager := testManagers()
+			return cmdManager.CheckItem(taskManager, task.GetFullIndex()+ITEM_SEPARATOR+n)
+		}
+
+		checked, completed, err := check("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completed || checked.checklistMarker() != " [1/2]" {
+			t.Errorf("after checking one item, completed %v with %q, want [1/2]",
+				completed, checked.checklistMarker())
+		}
+		if _, _, err := check("1"); err == nil {
+			t.Error("checking off an item twice should fail")
+		}
+		if _, _, err := check("3"); err == nil {
+			t.Error("checking off an item that isn't there should fail")
+		}
+
+		// The last item completes the task
+		_, completed, err = check("2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !completed {
+			t.Errorf("repeats %v: checking off every item didn't complete the task", repeats)
+		}
+		records, err := taskManager.AuditRecords()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var logged []string
+		for _, record := range records {
+			logged = append(logged, record.BodyContent)
+		}
+		want := []string{"decorate", "decorate: buy paint", "decorate: paint the wall"}
+		sort.Strings(logged)
+		if !equalStrings(logged, want) {
+			t.Errorf("repeats %v: logged %v, want %v", repeats, logged, want)
+		}
+		stored, err := taskManager.store().GetTask(task.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !repeats {
+			if stored != nil {
+				t.Errorf("completed task still stored: %v", stored)
+			}
+			continue
+		}
+		// Next time around, nothing's done
+		if stored == nil || !stored.DueDate.Equal(task.DueDate.AddDate(0, 0, 7)) ||
+			stored.checklistMarker() != " [0/2]" {
+			t.Errorf("next time around %v, want it due in a week with nothing done", stored)
+		}
+	}
+}
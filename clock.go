@@ -0,0 +1,52 @@
+package todo
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Tells the time. Everything that depends on what day it is asks a Clock
+// rather than calling time.Now, so it can be tested or previewed at any
+// time.
+type Clock interface {
+	Now() time.Time
+}
+
+// The actual time.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// A clock stopped at a time, e.g. to see what tomorrow's list looks like.
+type FixedClock struct {
+	Time time.Time
+}
+
+func (clock FixedClock) Now() time.Time {
+	return clock.Time
+}
+
+// The clock to use when none was given.
+func orSystemClock(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock{}
+	}
+	return clock
+}
+
+// The system clock, unless $TODO_NOW says to pretend it's another time,
+// e.g. TODO_NOW=tomorrow to see tomorrow's list.
+func EnvClock() (Clock, error) {
+	now := os.Getenv("TODO_NOW")
+	if now == "" {
+		return SystemClock{}, nil
+	}
+	pretend, err := ParseDate(now, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("Bad TODO_NOW: %v", err)
+	}
+	return FixedClock{Time: pretend}, nil
+}
@@ -0,0 +1,58 @@
+package todo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvClock(t *testing.T) {
+	t.Setenv("TODO_NOW", "2026/10/20")
+	clock, err := EnvClock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixed, isFixed := clock.(FixedClock)
+	if !isFixed || fixed.Now().Year() != 2026 || fixed.Now().YearDay() != 293 {
+		t.Errorf("EnvClock() = %v, want it stopped on 2026/10/20", clock)
+	}
+
+	t.Setenv("TODO_NOW", "")
+	if clock, err := EnvClock(); err != nil || clock != (SystemClock{}) {
+		t.Errorf("EnvClock() = %v, %v, want the system clock", clock, err)
+	}
+
+	t.Setenv("TODO_NOW", "someday")
+	if _, err := EnvClock(); err == nil {
+		t.Error("EnvClock() with a bad TODO_NOW should fail")
+	}
+}
+
+// What's due today depends only on the managers' clock.
+func TestListingClock(t *testing.T) {
+	taskManager, cmdManager := testManagers()
+	createTestTask(t, taskManager, "buy milk")
+	cmdManager.DueDate = testClock.Now().AddDate(0, 0, 1)
+	if _, err := cmdManager.CreateTask(taskManager, "call bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		now  time.Time
+		want []string
+	}{
+		{testClock.Now(), []string{":buy milk"}},
+		{testClock.Now().AddDate(0, 0, 1), []string{":buy milk", ":call bob"}},
+	}
+	for _, test := range tests {
+		clock := FixedClock{Time: test.now}
+		taskManager := &TaskManager{Store: taskManager.Store, Clock: clock}
+		cmdManager := &CommandManager{Clock: clock, DueDate: test.now, Listing: LISTING_DAY}
+		tasks, err := cmdManager.GetTasks(taskManager)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := taskBodies(tasks); !equalStrings(got, test.want) {
+			t.Errorf("on %v listed %v, want %v", test.now, got, test.want)
+		}
+	}
+}
@@ -3,11 +3,8 @@ package todo
 import (
 	"errors"
 	"fmt"
-	"math"
-	"os/exec"
-	"path"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,165 +13,117 @@ const (
 	LISTING_DAY
 )
 
-// This is done to reduce the number of read/writes for multiple operations
-var tasks *Tasks = nil
-
-func GetTasks(manager *TaskManager) *Tasks {
-	if tasks == nil {
-		tasks_ := manager.GetTasks()
-		tasks = &tasks_
-	}
-	return tasks
-}
-
-func ClearCache() {
-	tasks = nil
-}
-
-// Manages the state between commands
+// Manages the state between commands. Safe to use from several goroutines.
 type CommandManager struct {
+	mutex sync.Mutex
+	// This is done to reduce the number of read/writes for multiple operations
+	tasks *Tasks
+
 	// See LISTING enum
 	Listing     int
 	OverdueDays int
 	DueDate     time.Time
 	// If time is set manually we can behave differently
 	TimeSet bool
-	Repeat  *string
+	// Whether DueDate has a time of day that matters
+	HasDueTime bool
+	Repeat     *Recurrence
+	RepeatFrom RepeatAnchor
+	Reminders  []Reminder
+	Priority   Priority
+	// Listings only show tasks at least this important, if it's set.
+	MinPriority Priority
+	Tags        []string
+	Checklist   []ChecklistItem
+	Description string
+	// IDs of the tasks a new task waits on.
+	BlockedBy []string
+	// Listings, and the audit log, only show what this lets through.
+	TagFilter TagFilter
+	// Listings, and the audit log, only show what this matches, if set.
+	Query *Query
 	// If certain actions have been taken skip task creation from stdin
 	// This only makes sense for the command line.
 	SkipTaskCreationPrompt bool
 	// Annotation to add to the audit log when deleting a task.
 	Annotation string
+	// What the time is, which should be the same as the TaskManager's.
+	// If nil the system clock is used.
+	Clock Clock
 }
 
-// -t
-func (cmdManager *CommandManager) SetDueDate(newDueDate time.Time) {
-	cmdManager.DueDate = newDueDate
-	cmdManager.TimeSet = true
+func (cmdManager *CommandManager) now() time.Time {
+	return orSystemClock(cmdManager.Clock).Now()
 }
 
-func getHumanyNextDelay(daysString string) (time.Time, error) {
-	// Must be human-y
-	today := time.Now()
-	days := strings.Split(daysString, ",")
-	if len(days) == 0 {
-		return today, errors.New("Empty repeat is not allowed")
-	}
-	/* We want the lowest index day _after_ today's
-	where Sunday = 0, Saturday = 6
-	If there is no number after today then just the smallest one. */
-	todayIndex := int(today.Weekday())
-	dayIndices := make([]int, len(days))
-	for index, day := range days {
-		var err error
-		dayIndices[index], err = dayToIndex(day)
-		if err != nil {
-			return today, err
-		}
-	}
-	indexOfLowest := 0
-	for index, dayIndex := range dayIndices[1:] {
-		if dayIndices[indexOfLowest] < todayIndex && dayIndex < todayIndex {
-			indexOfLowest = index
-		}
-		if dayIndex > todayIndex && dayIndex < dayIndices[indexOfLowest] {
-			indexOfLowest = index
+// Corrupt tasks are reported and skipped, rather than failing the command.
+func (cmdManager *CommandManager) getTasks(taskManager *TaskManager) (*Tasks, error) {
+	if cmdManager.tasks == nil {
+		tasks, err := taskManager.GetTasks()
+		if IsCorrupt(err) {
+			LogError(err.Error())
+		} else if err != nil {
+			return nil, err
 		}
+		cmdManager.tasks = &tasks
 	}
-	if indexOfLowest == todayIndex {
-		return today.AddDate(0, 0, 7), nil
-	}
-	return humanyTime(days[indexOfLowest])
-}
-
-func dayToIndex(day string) (int, error) {
-	switch strings.Title(day) {
-	case "Sunday":
-		return 0, nil
-	case "Monday":
-		return 1, nil
-	case "Tuesday":
-		return 2, nil
-	case "Wednesday":
-		return 3, nil
-	case "Thursday":
-		return 4, nil
-	case "Friday":
-		return 5, nil
-	case "Saturday":
-		return 6, nil
-	default:
-		return 0, errors.New(fmt.Sprintf("Invalid day %s", day))
-	}
-}
-
-func humanyTime(day string) (time.Time, error) {
-	today := time.Now()
-	relativeDay := 0
-	curWeekday := int(today.Weekday())
-	switch strings.Title(day) {
-	case "Sunday":
-		relativeDay = 0
-	case "Monday":
-		relativeDay = 1
-	case "Tuesday":
-		relativeDay = 2
-	case "Wednesday":
-		relativeDay = 3
-	case "Thursday":
-		relativeDay = 4
-	case "Friday":
-		relativeDay = 5
-	case "Saturday":
-		relativeDay = 6
-	case "Tomorrow":
-		relativeDay = (curWeekday + 1) % 7
-	case "Today":
-		return today, nil
-	case "Yesterday":
-		return today.AddDate(0, 0, -1), nil
-	default:
-		return today, errors.New(fmt.Sprintf("Invalid human-y day %s", day))
-	}
-	if curWeekday < relativeDay {
-		return today.AddDate(0, 0, int(relativeDay-curWeekday)), nil
-	} else {
-		return today.AddDate(0, 0, 7-(curWeekday-relativeDay)), nil
-	}
+	return cmdManager.tasks, nil
+}
+
+// Forgets the tasks read so far, so they are read again from the store.
+func (cmdManager *CommandManager) ClearCache() {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	cmdManager.tasks = nil
 }
 
 // -t
-func (cmdManager *CommandManager) SetDueDateRelative(newDueDate string) error {
+func (cmdManager *CommandManager) SetDueDate(newDueDate time.Time) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	cmdManager.DueDate = newDueDate
 	cmdManager.TimeSet = true
-	humanDueDate, err := humanyTime(newDueDate)
-	if err != nil {
-		cmdManager.DueDate = humanDueDate
-		return nil
-	}
-	// Attempt to use date as a fallback, using ISO-8601 format
-	var dueDate time.Time
-	out, err := exec.Command("/usr/bin/date", "--iso-8601", "-d", newDueDate).Output()
+}
+
+// -t, anything ParseDate reads
+func (cmdManager *CommandManager) SetDueDateRelative(newDueDate string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	dueDate, hasTime, err := ParseDateTime(newDueDate, cmdManager.now())
 	if err != nil {
-		return errors.New(fmt.Sprintf("/usr/bin/date failed: %v", err))
+		return err
 	}
-	newDueDate = strings.ReplaceAll(strings.TrimSpace(string(out)), "-", "/")
-	zone, _ := time.Now().Zone()
-	dueDate, err = time.Parse(EXPLICIT_TIME_FORMAT, fmt.Sprintf("%s %s", newDueDate, zone))
+	cmdManager.DueDate = dueDate
+	cmdManager.HasDueTime = hasTime
+	cmdManager.TimeSet = true
+	return nil
+}
+
+// -b, anything ParseReminder reads
+func (cmdManager *CommandManager) AddReminder(reminder string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	parsed, err := ParseReminder(reminder)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Bad date: %s", newDueDate))
+		return err
 	}
-	cmdManager.DueDate = dueDate
+	cmdManager.Reminders = append(cmdManager.Reminders, parsed)
 	return nil
 }
 
 // -l
 func (cmdManager *CommandManager) GetTasks(taskManager *TaskManager) (Tasks, error) {
-	allTasks := GetTasks(taskManager)
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	allTasks, err := cmdManager.getTasks(taskManager)
+	if err != nil {
+		return nil, err
+	}
 	cmdManager.Listing = LISTING_DAY
 	cmdManager.SkipTaskCreationPrompt = true
 
 	var tasks Tasks
-	if cmdManager.DueDate.Before(time.Now()) && !cmdManager.TimeSet {
+	if !cmdManager.DueDate.After(cmdManager.now()) && !cmdManager.TimeSet {
 		tasks = allTasks.FilterTasksDueBeforeToday()
 		if len(tasks) == 0 {
 			tasks = *allTasks
@@ -183,27 +132,44 @@ func (cmdManager *CommandManager) GetTasks(taskManager *TaskManager) (Tasks, err
 		tasks = allTasks.FilterTasksDueOnDay(cmdManager.DueDate)
 	}
 
-	return tasks, nil
+	// Blocked tasks can't be worked on yet, -a still shows them
+	return tasks.FilterTasksUnblocked().
+		FilterTasksByPriority(cmdManager.MinPriority).
+		FilterTasksByTags(cmdManager.TagFilter).
+		FilterTasksByQuery(cmdManager.Query), nil
 }
 
 // What -a should be, don't list until we know we aren't gonna need to pipe
 func (cmdManager *CommandManager) UseAllTasks() {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
 	cmdManager.Listing = LISTING_ALL
 }
 
 // -s
 func (cmdManager *CommandManager) SkipTask(taskManager *TaskManager, index string) error {
-	skip_task := GetTasks(taskManager).GetByHash(index)
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	allTasks, err := cmdManager.getTasks(taskManager)
+	if err != nil {
+		return err
+	}
+	skip_task, err := allTasks.Find(index)
+	if err != nil {
+		return err
+	}
 	if skip_task.Repeat == nil {
 		return errors.New("Can only skip repeat tasks")
 	}
-	_, err := cmdManager.deleteTaskHelper(taskManager, index, false, true)
+	_, err = cmdManager.deleteTaskHelper(taskManager, index, false, true)
 	return err
 }
 
 // -D (true) and -d (false)
 func (cmdManager *CommandManager) DeleteTask(taskManager *TaskManager, index string,
 	force_delete bool) (*Task, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
 
 	task, err := cmdManager.deleteTaskHelper(taskManager, index, force_delete, false)
 	if err == nil && task == nil {
@@ -220,14 +186,17 @@ func (cmdManager *CommandManager) deleteTaskHelper(taskManager *TaskManager, ind
 		panic("force_delete and skip_repeat cannot both be true")
 	}
 
-	allTasks := GetTasks(taskManager)
+	allTasks, err := cmdManager.getTasks(taskManager)
+	if err != nil {
+		return nil, err
+	}
 	cmdManager.SkipTaskCreationPrompt = true
 	var taskDeleted *Task
 
 	switch cmdManager.Listing {
 	case LISTING_DAY:
 		var tasks Tasks
-		if cmdManager.DueDate.Before(time.Now()) {
+		if !cmdManager.DueDate.After(cmdManager.now()) {
 			// NOTE This is a special case: we want everything due today
 			// or before today with this call..
 			tasks = allTasks.FilterTasksDueBeforeToday()
@@ -235,8 +204,11 @@ func (cmdManager *CommandManager) deleteTaskHelper(taskManager *TaskManager, ind
 			tasks = allTasks.FilterTasksDueOnDay(cmdManager.DueDate)
 		}
 		if len(tasks) != 0 {
-			taskDeleted = taskManager.DeleteTask(tasks, index)
-			if taskDeleted != nil && taskDeleted.Repeat == nil {
+			taskDeleted, err = tasks.Find(index)
+			if err != nil {
+				return nil, err
+			}
+			if taskDeleted.Repeat == nil {
 				allTasks.RemoveFirst(*taskDeleted)
 			}
 			break
@@ -246,91 +218,222 @@ func (cmdManager *CommandManager) deleteTaskHelper(taskManager *TaskManager, ind
 		// tasks today.
 		fallthrough
 	case LISTING_ALL:
-		taskDeleted = (taskManager).DeleteTask(*allTasks, index)
-		if taskDeleted != nil {
-			allTasks.RemoveFirst(*taskDeleted)
+		taskDeleted, err = allTasks.Find(index)
+		if err != nil {
+			return nil, err
 		}
+		allTasks.RemoveFirst(*taskDeleted)
 	}
 
-	if taskDeleted == nil {
-		return nil, errors.New(fmt.Sprintf("Bad index \"%s\"", index))
-	}
+	// Removing the task, recreating it and logging it happen together
+	tx := Transaction{Delete: Tasks{*taskDeleted}}
+	completed := *taskDeleted
 
 	if !force_delete && taskDeleted.Repeat != nil {
 		// Recreate the task if it has a repeat.
-		delay, err := strconv.Atoi(*taskDeleted.Repeat)
+		*taskDeleted, err = taskDeleted.nextOccurrence(cmdManager.DueDate)
 		if err != nil {
-			taskDeleted.DueDate, err = getHumanyNextDelay(*taskDeleted.Repeat)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			taskDeleted.DueDate = taskDeleted.DueDate.AddDate(0, 0, delay)
-		}
-		if err := taskManager.SaveTask(taskDeleted); err != nil {
 			return nil, err
 		}
+		tx = taskManager.ReplaceTask(completed, taskDeleted)
 	}
 
 	// Log in the audit log
 	if !force_delete && !skip_repeat {
-		original_StorageDirectory := taskManager.StorageDirectory
-		if taskDeleted.category != nil {
-			taskManager.StorageDirectory = path.Join(taskManager.StorageDirectory, *taskDeleted.category)
-		}
-		taskManager.AuditLog(*taskDeleted, cmdManager.DueDate, cmdManager.Annotation)
-		taskManager.StorageDirectory = original_StorageDirectory
+		tx.Records = append(tx.Records,
+			NewRecord(completed, cmdManager.DueDate, cmdManager.Annotation))
+	}
+
+	commit := cmdManager.commitDone
+	if skip_repeat {
+		commit = cmdManager.commitUnchanged
+	}
+	if err := commit(taskManager, completed, tx); err != nil {
+		return nil, err
 	}
 
 	return taskDeleted, nil
 }
 
-// Remove tasks that are overdue by 3 days.
-func (cmdManager *CommandManager) RemoveOverdueTasks(tasks Tasks, taskManager *TaskManager) {
-	for _, task := range tasks {
-		finalDueDate := task.DueDate.AddDate(0, 0, task.OverdueDays)
-		overdue_days := int(math.Floor(time.Now().Sub(finalDueDate).Hours() / 24))
-		if overdue_days > 3 {
-			// TODO Remove once I'm used to this feature
-			LogError(fmt.Sprintf("Auto removing overdue task \"%v\"",
-				task.BodyContent))
-			if task.Repeat == nil {
-				cmdManager.deleteTaskHelper(taskManager, task.fullIndex, true, false)
-			} else {
-				cmdManager.deleteTaskHelper(taskManager, task.fullIndex, false, true)
-			}
+// Commits a transaction based on a task, as long as nobody else changed the
+// task since it was read. Otherwise the tasks are read again next time.
+func (cmdManager *CommandManager) commitUnchanged(taskManager *TaskManager,
+	task Task, tx Transaction) error {
+	return cmdManager.commit(taskManager, task, tx, false)
+}
+
+// Same as commitUnchanged, for a transaction that's done with the task,
+// completing or deleting it, so the tasks waiting on it stop waiting.
+func (cmdManager *CommandManager) commitDone(taskManager *TaskManager,
+	task Task, tx Transaction) error {
+	return cmdManager.commit(taskManager, task, tx, true)
+}
+
+func (cmdManager *CommandManager) commit(taskManager *TaskManager,
+	task Task, tx Transaction, done bool) error {
+
+	unlock, err := taskManager.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := taskManager.CheckUnchanged(task); err != nil {
+		cmdManager.tasks = nil
+		return err
+	}
+	if done {
+		if err := taskManager.unblockDependents(&tx, task.ID); err != nil {
+			return err
 		}
 	}
+	if err := taskManager.checkMoves(tx); err != nil {
+		return err
+	}
+	if err := taskManager.checkDependencies(tx); err != nil {
+		return err
+	}
+	if err := taskManager.Commit(tx); err != nil {
+		return err
+	}
+	if done && cmdManager.tasks != nil {
+		// Keep the tasks that were read in step, so the ones that stopped
+		// waiting can still be found by the same index
+		cmdManager.tasks.unblock(task.ID)
+	}
+	return nil
 }
 
-// -r
-func (cmdManager *CommandManager) SetRepeatHumany(days string) error {
-	for _, day := range strings.Split(days, ",") {
-		switch strings.Title(day) {
-		case "Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday":
-			continue
-		default:
-			return errors.New(fmt.Sprintf("Invalid repeat day %s", day))
-		}
+// Purge overdue tasks as their categories' policies say, reporting each one.
+func (cmdManager *CommandManager) RemoveOverdueTasks(tasks Tasks, taskManager *TaskManager,
+	policies PurgePolicies) error {
+	purges := cmdManager.PlanPurge(tasks, policies)
+	for _, purge := range purges {
+		LogError(purge.String())
+	}
+	return cmdManager.Purge(taskManager, purges)
+}
+
+// -r, anything ParseRecurrence reads
+func (cmdManager *CommandManager) SetRepeat(repeat string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	rule, err := ParseRecurrence(repeat)
+	if err != nil {
+		return err
 	}
-	cmdManager.Repeat = &days
+	cmdManager.Repeat = rule
 	return nil
 }
 
-// -r
-func (cmdManager *CommandManager) SetRepeat(days int) error {
-	if days <= 0 {
-		return errors.New("Repeat time must be a positive, non-zero number")
+// -P, anything ParsePriority reads
+func (cmdManager *CommandManager) SetPriority(priority string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	parsed, err := ParsePriority(priority)
+	if err != nil {
+		return err
+	}
+	cmdManager.Priority = parsed
+	return nil
+}
+
+// -p, anything ParsePriority reads
+func (cmdManager *CommandManager) SetMinPriority(priority string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	parsed, err := ParsePriority(priority)
+	if err != nil {
+		return err
+	}
+	cmdManager.MinPriority = parsed
+	return nil
+}
+
+// -T, anything CleanTag accepts
+func (cmdManager *CommandManager) AddTag(tag string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	cleaned, err := CleanTag(tag)
+	if err != nil {
+		return err
+	}
+	cmdManager.Tags = append(cmdManager.Tags, cleaned)
+	return nil
+}
+
+// -m, kept as written apart from trailing blank lines
+func (cmdManager *CommandManager) SetDescription(description string) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	cmdManager.Description = strings.TrimRight(description, " \t\n")
+}
+
+// -i
+func (cmdManager *CommandManager) AddItem(item string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	items, err := NewChecklist([]string{item})
+	if err != nil {
+		return err
+	}
+	cmdManager.Checklist = append(cmdManager.Checklist, items...)
+	return nil
+}
+
+// -B, waits on the task with this index. An empty index waits on nothing.
+func (cmdManager *CommandManager) AddBlocker(taskManager *TaskManager, index string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	if index == "" {
+		cmdManager.BlockedBy = []string{}
+		return nil
+	}
+	allTasks, err := cmdManager.getTasks(taskManager)
+	if err != nil {
+		return err
+	}
+	blocker, err := allTasks.Find(index)
+	if err != nil {
+		return err
 	}
+	if hasTag(cmdManager.BlockedBy, blocker.ID) {
+		return errors.New(fmt.Sprintf("Already waiting on \"%s\"", blocker.BodyContent))
+	}
+	cmdManager.BlockedBy = append(cmdManager.BlockedBy, blocker.ID)
+	return nil
+}
 
-	hours := strconv.Itoa(int(days))
-	cmdManager.Repeat = &hours
+// -F, anything ParseTagFilter reads. Every filter given has to match.
+func (cmdManager *CommandManager) AddTagFilter(filter string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	parsed, err := ParseTagFilter(filter)
+	if err != nil {
+		return err
+	}
+	cmdManager.TagFilter = cmdManager.TagFilter.And(parsed)
+	return nil
+}
 
+// -q, anything ParseQuery reads. Every query given has to match.
+func (cmdManager *CommandManager) AddQuery(query string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	if cmdManager.Query != nil {
+		query = "(" + cmdManager.Query.Text + ") (" + query + ")"
+	}
+	parsed, err := ParseQuery(query, cmdManager.now())
+	if err != nil {
+		return err
+	}
+	cmdManager.Query = parsed
 	return nil
 }
 
 // -n
 func (cmdManager *CommandManager) SetDelay(days int) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
 	if days <= 0 {
 		return errors.New("Delay time must be a positive, non-zero number")
 	}
@@ -340,10 +443,15 @@ func (cmdManager *CommandManager) SetDelay(days int) error {
 
 // -x
 func (cmdManager *CommandManager) DelayTask(taskManager *TaskManager, index string) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
 	cmdManager.SkipTaskCreationPrompt = true
 	// Always do a re-read for delays. Makes them both more expensive and multiple delays work.
-	tasks = nil
-	allTasks := GetTasks(taskManager)
+	cmdManager.tasks = nil
+	allTasks, err := cmdManager.getTasks(taskManager)
+	if err != nil {
+		return err
+	}
 
 	var tasks Tasks
 	switch cmdManager.Listing {
@@ -353,68 +461,157 @@ func (cmdManager *CommandManager) DelayTask(taskManager *TaskManager, index stri
 		tasks = allTasks.FilterTasksDueBeforeToday()
 	}
 
-	taskDeleted := taskManager.DeleteTask(tasks, index)
-	if taskDeleted == nil {
-		return errors.New(fmt.Sprintf("Bad index \"%s\"", index))
+	taskDeleted, err := tasks.Find(index)
+	if err != nil {
+		return err
 	}
+	original := *taskDeleted
 
 	if cmdManager.TimeSet {
-		taskDeleted.DueDate = cmdManager.DueDate
+		taskDeleted.setDueDate(cmdManager.DueDate)
+		taskDeleted.HasDueTime = cmdManager.HasDueTime
 	} else {
 		taskDeleted.DueDate = taskDeleted.DueDate.AddDate(0, 0, 1)
 	}
 
-	err := taskManager.SaveTask(taskDeleted)
-	return err
+	return cmdManager.commitUnchanged(taskManager, original,
+		taskManager.ReplaceTask(original, taskDeleted))
+}
+
+// -E, changes a task in place. The task keeps its identity and nothing is
+// logged in the audit log.
+func (cmdManager *CommandManager) EditTask(taskManager *TaskManager, index string,
+	changes TaskChanges) (*Task, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	cmdManager.SkipTaskCreationPrompt = true
+
+	allTasks, err := cmdManager.getTasks(taskManager)
+	if err != nil {
+		return nil, err
+	}
+	original, err := allTasks.Find(index)
+	if err != nil {
+		return nil, err
+	}
+	if changes.Category != nil && *changes.Category != "" {
+		exists, err := taskManager.CategoryExists(*changes.Category)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errors.New(fmt.Sprintf("Category \"%s\" does not exist",
+				*changes.Category))
+		}
+	}
+	edited, err := changes.Apply(*original)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmdManager.commitUnchanged(taskManager, *original,
+		taskManager.ReplaceTask(*original, &edited))
+	if err != nil {
+		return nil, err
+	}
+	cmdManager.tasks = nil
+	// Keep showing it by the index it was edited by
+	edited.index = original.index
+	return &edited, nil
+}
+
+// -M, moves tasks to another category
+func (cmdManager *CommandManager) MoveTasks(taskManager *TaskManager, indices []string,
+	category string) (Tasks, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	cmdManager.SkipTaskCreationPrompt = true
+
+	allTasks, err := cmdManager.getTasks(taskManager)
+	if err != nil {
+		return nil, err
+	}
+	moved, err := taskManager.MoveTasks(*allTasks, indices, category)
+	cmdManager.tasks = nil
+	return moved, err
 }
 
 // -L, forwards the call and sets the prompt skip
-func (cmdManager *CommandManager) GetCategories(taskManager *TaskManager) Categories {
+func (cmdManager *CommandManager) GetCategories(taskManager *TaskManager) (Categories, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
 	cmdManager.SkipTaskCreationPrompt = true
 	return taskManager.GetCategories()
 }
 
+// -G
+func (cmdManager *CommandManager) GetTags(taskManager *TaskManager) (Tags, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	cmdManager.SkipTaskCreationPrompt = true
+	return taskManager.GetTags()
+}
+
 // -A
-func (cmdManager *CommandManager) GetAuditLog(taskManager *TaskManager) Records {
+func (cmdManager *CommandManager) GetAuditLog(taskManager *TaskManager) (Records, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
 	cmdManager.SkipTaskCreationPrompt = true
 
-	records := taskManager.AuditRecords()
-	if !cmdManager.TimeSet {
-		return records
+	records, err := taskManager.AuditRecords()
+	records = records.FilterRecordsByTags(cmdManager.TagFilter).
+		FilterRecordsByQuery(cmdManager.Query)
+	if err != nil || !cmdManager.TimeSet {
+		return records, err
 	}
 
-	year, month, day := cmdManager.DueDate.Year(),
-		cmdManager.DueDate.Month(),
-		cmdManager.DueDate.Day()
-
-	midnight := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	midnight := startOfDay(cmdManager.DueDate)
 	var filteredRecords Records
 	for _, record := range records {
 		if record.DateCompleted.After(midnight) {
 			filteredRecords = append(filteredRecords, record)
 		}
 	}
-	return filteredRecords
+	return filteredRecords, nil
 }
 
 // -a, at the end if no action taken. Only call at the end, if tasks should be returned
 // we will do so.
-func (cmdManager *CommandManager) GetTasksIfAll(taskManager *TaskManager) Tasks {
+func (cmdManager *CommandManager) GetTasksIfAll(taskManager *TaskManager) (Tasks, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
 	if cmdManager.Listing == LISTING_ALL && !cmdManager.SkipTaskCreationPrompt {
 		cmdManager.SkipTaskCreationPrompt = true
-		allTasks := GetTasks(taskManager)
-		return *allTasks
+		allTasks, err := cmdManager.getTasks(taskManager)
+		if err != nil {
+			return nil, err
+		}
+		return allTasks.FilterTasksByPriority(cmdManager.MinPriority).
+			FilterTasksByTags(cmdManager.TagFilter).
+			FilterTasksByQuery(cmdManager.Query), nil
 	}
-	return Tasks{}
+	return Tasks{}, nil
 }
 
 func (cmdManager *CommandManager) CreateTask(taskManager *TaskManager,
 	input string) (*Task, error) {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
 	task, err := NewTask(input, cmdManager.DueDate,
 		cmdManager.Repeat, cmdManager.OverdueDays)
 	if err != nil {
 		return nil, err
 	}
+	task.RepeatFrom = cmdManager.RepeatFrom
+	task.HasDueTime = cmdManager.HasDueTime
+	task.Reminders = cmdManager.Reminders
+	task.Priority = cmdManager.Priority
+	task.Tags = mergeTags(task.Tags, cmdManager.Tags)
+	task.Checklist = cmdManager.Checklist
+	if cmdManager.Description != "" {
+		task.Description = cmdManager.Description
+	}
+	task.BlockedBy = cmdManager.BlockedBy
 
 	err = taskManager.SaveTask(&task)
 	if err != nil {
@@ -0,0 +1,124 @@
+package todo
+
+import (
+	"testing"
+	"time"
+)
+
+// Managers for a command run against an empty store, as of testClock.
+func testManagers() (*TaskManager, *CommandManager) {
+	taskManager := &TaskManager{Store: NewMemoryStore(), Clock: testClock}
+	cmdManager := &CommandManager{Clock: testClock, DueDate: testClock.Now(), Listing: LISTING_DAY}
+	return taskManager, cmdManager
+}
+
+// Creates a task due today the way the command line does.
+func createTestTask(t *testing.T, taskManager *TaskManager, body string) Task {
+	_, cmdManager := testManagers()
+	task, err := cmdManager.CreateTask(taskManager, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *task
+}
+
+// The task as it's stored now.
+func storedTask(t *testing.T, taskManager *TaskManager, task Task) Task {
+	stored, err := taskManager.store().GetTask(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil {
+		t.Fatalf("%q isn't stored", task.BodyContent)
+	}
+	return *stored
+}
+
+func TestEditTask(t *testing.T) {
+	taskManager, cmdManager := testManagers()
+	task := createTestTask(t, taskManager, "paint the wall")
+
+	body := "paint the fence"
+	due := time.Date(2026, 10, 24, 0, 0, 0, 0, time.UTC)
+	repeat := "weekly"
+	overdueDays := 2
+	home := "home"
+	changes := TaskChanges{BodyContent: &body, DueDate: &due, Repeat: &repeat,
+		OverdueDays: &overdueDays, Category: &home}
+	if _, err := cmdManager.EditTask(taskManager, task.GetFullIndex(), changes); err == nil {
+		t.Error("editing a task into a category that doesn't exist should fail")
+	}
+	if err := taskManager.CreateCategory(home); err != nil {
+		t.Fatal(err)
+	}
+	edited, err := cmdManager.EditTask(taskManager, task.GetFullIndex(), changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.GetFullIndex() != task.GetFullIndex() {
+		t.Errorf("edited task shown as %s, want %s", edited.GetFullIndex(), task.GetFullIndex())
+	}
+
+	stored := storedTask(t, taskManager, task)
+	if stored.BodyContent != body || !stored.DueDate.Equal(due) || stored.OverdueDays != overdueDays ||
+		stored.Category() != home || stored.Repeat == nil || stored.Repeat.Frequency != WEEKLY {
+		t.Errorf("stored %#v, want every change made", stored)
+	}
+	tasks, err := taskManager.GetTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 {
+		t.Errorf("%d tasks after editing, want the one", len(tasks))
+	}
+	records, err := taskManager.AuditRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("editing logged %v in the audit log", records)
+	}
+
+	// An empty repeat stops it repeating
+	noRepeat := ""
+	_, cmdManager = testManagers()
+	cmdManager.Listing = LISTING_ALL
+	if _, err := cmdManager.EditTask(taskManager, stored.GetFullIndex(), TaskChanges{Repeat: &noRepeat}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedTask(t, taskManager, task); stored.Repeat != nil {
+		t.Errorf("still repeats %v", stored.Repeat)
+	}
+}
+
+func TestCompleteRepeatingTask(t *testing.T) {
+	for _, test := range []struct {
+		from RepeatAnchor
+		want time.Time
+	}{
+		{FROM_DUE_DATE, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{FROM_COMPLETION, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+	} {
+		taskManager, cmdManager := testManagers()
+		cmdManager.DueDate = time.Date(2026, 10, 10, 0, 0, 0, 0, time.UTC)
+		cmdManager.Repeat = &Recurrence{Frequency: DAILY, Interval: 7}
+		cmdManager.RepeatFrom = test.from
+		task, err := cmdManager.CreateTask(taskManager, "water the plants")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Done a week and a day late
+		_, cmdManager = testManagers()
+		cmdManager.Listing = LISTING_ALL
+		if _, err := cmdManager.DeleteTask(taskManager, task.GetFullIndex(), false); err != nil {
+			t.Fatal(err)
+		}
+		if next := storedTask(t, taskManager, *task); !is_same_day(next.DueDate, test.want) {
+			t.Errorf("repeating from %s, next due %v, want %v", test.from, next.DueDate, test.want)
+		}
+		if records, err := taskManager.AuditRecords(); err != nil || len(records) != 1 {
+			t.Errorf("repeating from %s, audit log %v, %v, want the one record", test.from, records, err)
+		}
+	}
+}
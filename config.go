@@ -0,0 +1,49 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// Settings from the config file, see DefaultConfigPath.
+type Config struct {
+	// Run for each reminder by "todo -N", through sh with the task's
+	// body as $1 and when it's due as $2, e.g.
+	// "notify-send \"$1\" \"due $2\"". Without one reminders are printed.
+	RemindCommand string `json:",omitempty"`
+	// What happens to tasks left overdue, by category, e.g.
+	// {"": {"Action": "drop", "Days": 7}, "work": {"Action": "never"}}
+	Purge PurgePolicies `json:",omitempty"`
+	// The colours output is shown in, only those given changing from
+	// DEFAULT_THEME, e.g. {"Overdue": "bold red", "Greyed": "dim"}.
+	Theme Theme
+}
+
+// $XDG_CONFIG_HOME/todo/config.json, or ~/.config/todo/config.json.
+func DefaultConfigPath() string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = path.Join(os.Getenv("HOME"), ".config")
+	}
+	return path.Join(configHome, "todo", "config.json")
+}
+
+// Reads a config file. A file that doesn't exist is an empty config, with
+// DEFAULT_THEME.
+func LoadConfig(fileName string) (Config, error) {
+	config := Config{Theme: DEFAULT_THEME}
+	bytes, err := ioutil.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(bytes, &config); err != nil {
+		return config, errors.New(fmt.Sprintf("Bad config \"%s\": %v", fileName, err))
+	}
+	return config, nil
+}
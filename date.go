@@ -0,0 +1,311 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var isoDate = regexp.MustCompile(`^(\d{4})[-/](\d{1,2})[-/](\d{1,2})(?:t(\d{1,2}):(\d{2}))?$`)
+var timeOfDay = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+
+// Words that only make a date read better, e.g. "on friday at 3pm".
+var dateFillers = map[string]bool{
+	"at": true, "on": true, "the": true, "of": true, "by": true, "in": true,
+	"due": true,
+}
+
+var dateUnits = map[string]Frequency{
+	"day": DAILY, "days": DAILY,
+	"week": WEEKLY, "weeks": WEEKLY,
+	"month": MONTHLY, "months": MONTHLY,
+	"year": YEARLY, "years": YEARLY,
+}
+
+// Parses a date, relative to now. Understands
+//
+//   - dates, e.g. "2026/10/20", "2026-10-20", "jan 5", "5 january 2027"
+//   - days, e.g. "today", "tomorrow", "friday", "next friday", "last monday"
+//   - offsets, e.g. "in 3 days", "2 weeks", "next month", "3 days ago"
+//   - "end of week", "end of month" and "end of year"
+//   - times of day, on their own or with any of the above, e.g. "15:30",
+//     "3pm", "tomorrow at noon"
+//
+// Without a time of day the date is at midnight. Dates are in now's
+// location. A weekday on its own is the next one after today, and a
+// month and day without a year is the next one from today.
+func ParseDate(text string, now time.Time) (time.Time, error) {
+	date, _, err := ParseDateTime(text, now)
+	return date, err
+}
+
+// Same as ParseDate, also saying whether a time of day was given.
+func ParseDateTime(text string, now time.Time) (time.Time, bool, error) {
+	bad := func(format string, args ...interface{}) (time.Time, bool, error) {
+		return now, false, errors.New(fmt.Sprintf("Bad date \"%s\": ", text) +
+			fmt.Sprintf(format, args...))
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	day := today
+	daySet := false
+	hour, minute := 0, 0
+	timeSet := false
+	setDay := func(newDay time.Time) bool {
+		if daySet {
+			return false
+		}
+		day, daySet = newDay, true
+		return true
+	}
+
+	words := strings.Fields(strings.ToLower(strings.Replace(text, ",", " ", -1)))
+	if len(words) == 0 {
+		return bad("no date given")
+	}
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		next := ""
+		if i+1 < len(words) {
+			next = words[i+1]
+		}
+		weekday, isWeekday := friendlyWeekday(word)
+		month, isMonth := friendlyMonth(word)
+		var newDay time.Time
+		switch {
+		case word == "now":
+			newDay = today
+			hour, minute, timeSet = now.Hour(), now.Minute(), true
+		case word == "today":
+			newDay = today
+		case word == "tomorrow":
+			newDay = today.AddDate(0, 0, 1)
+		case word == "yesterday":
+			newDay = today.AddDate(0, 0, -1)
+		case isWeekday:
+			newDay = weekdayAfter(today, weekday, 1)
+		case (word == "next" || word == "this" || word == "last") && next != "":
+			i++
+			offset := map[string]int{"next": 1, "this": 0, "last": -1}[word]
+			if weekday, isWeekday := friendlyWeekday(next); isWeekday {
+				newDay = weekdayAfter(today, weekday, offset)
+			} else if unit, isUnit := dateUnits[next]; isUnit {
+				newDay = addUnits(today, unit, offset)
+			} else {
+				return bad("don't know \"%s %s\"", word, next)
+			}
+		case word == "end":
+			for i+1 < len(words) && dateFillers[words[i+1]] {
+				i++
+			}
+			if i+1 >= len(words) {
+				return bad("end of what?")
+			}
+			i++
+			switch words[i] {
+			case "week":
+				newDay = weekdayAfter(today, time.Sunday, 0)
+			case "month":
+				newDay = time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, today.Location())
+			case "year":
+				newDay = time.Date(today.Year(), 12, 31, 0, 0, 0, 0, today.Location())
+			default:
+				return bad("don't know the end of \"%s\"", words[i])
+			}
+		case isMonth:
+			// e.g. "jan 5", "jan 5th 2027"
+			dayOfMonth, ok := parseDayOfMonth(next)
+			if !ok {
+				return bad("\"%s\" needs a day", word)
+			}
+			i++
+			year, hasYear := parseYear(words, &i)
+			if newDay, ok = monthDay(today, year, hasYear, month, dayOfMonth); !ok {
+				return bad("no such day")
+			}
+		case dateUnits[next] != 0 && (word == "a" || word == "an" || isNumber(word)):
+			// e.g. "3 days", "a week ago"
+			count := 1
+			if isNumber(word) {
+				count, _ = strconv.Atoi(word)
+			}
+			unit := dateUnits[next]
+			i++
+			if i+1 < len(words) && words[i+1] == "ago" {
+				count = -count
+				i++
+			}
+			newDay = addUnits(today, unit, count)
+		case isNumber(word) && next != "":
+			// e.g. "5 jan"
+			month, isMonth := friendlyMonth(next)
+			dayOfMonth, ok := parseDayOfMonth(word)
+			if !isMonth || !ok {
+				if hour, minute, ok = parseTimeOfDay(word, next); ok {
+					// e.g. "3 pm"
+					i++
+					timeSet = true
+					continue
+				}
+				return bad("don't know \"%s\"", word)
+			}
+			i++
+			year, hasYear := parseYear(words, &i)
+			if newDay, ok = monthDay(today, year, hasYear, month, dayOfMonth); !ok {
+				return bad("no such day")
+			}
+		case isoDate.MatchString(word):
+			match := isoDate.FindStringSubmatch(word)
+			year, _ := strconv.Atoi(match[1])
+			month, _ := strconv.Atoi(match[2])
+			dayOfMonth, _ := strconv.Atoi(match[3])
+			if month < 1 || month > 12 || dayOfMonth < 1 ||
+				dayOfMonth > daysInMonth(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)) {
+				return bad("no such day")
+			}
+			newDay = time.Date(year, time.Month(month), dayOfMonth, 0, 0, 0, 0, now.Location())
+			if match[4] != "" {
+				hour, _ = strconv.Atoi(match[4])
+				minute, _ = strconv.Atoi(match[5])
+				if hour > 23 || minute > 59 {
+					return bad("no such time")
+				}
+				timeSet = true
+			}
+		case word == "noon" || word == "midday":
+			hour, minute, timeSet = 12, 0, true
+			continue
+		case word == "midnight":
+			hour, minute, timeSet = 0, 0, true
+			continue
+		case dateFillers[word]:
+			continue
+		default:
+			var ok bool
+			if hour, minute, ok = parseTimeOfDay(word, next); !ok {
+				return bad("don't know \"%s\"", word)
+			}
+			if next == "am" || next == "pm" {
+				i++
+			}
+			timeSet = true
+			continue
+		}
+		if !setDay(newDay) {
+			return bad("more than one date")
+		}
+	}
+	if timeSet {
+		day = time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+	}
+	return day, timeSet, nil
+}
+
+// The day a weekday falls on: offset 1 is the next one after today, 0 is
+// today or the next one and -1 the last one before today.
+func weekdayAfter(today time.Time, weekday time.Weekday, offset int) time.Time {
+	days := (int(weekday) - int(today.Weekday()) + 7) % 7
+	switch {
+	case offset > 0 && days == 0:
+		days = 7
+	case offset < 0:
+		days -= 7
+		if days == 0 {
+			days = -7
+		}
+	}
+	return today.AddDate(0, 0, days)
+}
+
+func addUnits(day time.Time, unit Frequency, count int) time.Time {
+	switch unit {
+	case WEEKLY:
+		return day.AddDate(0, 0, 7*count)
+	case MONTHLY:
+		return day.AddDate(0, count, 0)
+	case YEARLY:
+		return day.AddDate(count, 0, 0)
+	}
+	return day.AddDate(0, 0, count)
+}
+
+// The day in a month, in the given year or, without one, the next time it
+// comes around. False if the month has no such day, e.g. "feb 30".
+func monthDay(today time.Time, year int, hasYear bool, month time.Month, dayOfMonth int) (time.Time, bool) {
+	if !hasYear {
+		// 2000 was a leap year, so it has every day there can be
+		if dayOfMonth > daysInMonth(time.Date(2000, month, 1, 0, 0, 0, 0, time.UTC)) {
+			return today, false
+		}
+		year = today.Year()
+		if month < today.Month() || month == today.Month() && dayOfMonth < today.Day() {
+			year++
+		}
+		// "feb 29" is in the next leap year
+		for dayOfMonth > daysInMonth(time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)) {
+			year++
+		}
+	} else if dayOfMonth > daysInMonth(time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)) {
+		return today, false
+	}
+	return time.Date(year, month, dayOfMonth, 0, 0, 0, 0, today.Location()), true
+}
+
+// Parses "5" or "5th".
+func parseDayOfMonth(word string) (int, bool) {
+	day, isOrdinal := friendlyOrdinal(word)
+	if !isOrdinal {
+		var err error
+		if day, err = strconv.Atoi(word); err != nil {
+			return 0, false
+		}
+	}
+	return day, day >= 1 && day <= 31
+}
+
+// Reads a year following a date, if there is one.
+func parseYear(words []string, i *int) (int, bool) {
+	if *i+1 >= len(words) || len(words[*i+1]) != 4 || !isNumber(words[*i+1]) {
+		return 0, false
+	}
+	*i++
+	year, _ := strconv.Atoi(words[*i])
+	return year, true
+}
+
+// Parses "15:30", "3pm" or "3:30pm", or "3" followed by "pm".
+func parseTimeOfDay(word, next string) (hour, minute int, ok bool) {
+	match := timeOfDay.FindStringSubmatch(word)
+	if match == nil {
+		return 0, 0, false
+	}
+	meridiem := match[3]
+	if meridiem == "" && (next == "am" || next == "pm") {
+		meridiem = next
+	}
+	// A bare number isn't a time, it's probably a day or a count
+	if match[2] == "" && meridiem == "" {
+		return 0, 0, false
+	}
+	hour, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	if meridiem != "" {
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if meridiem == "pm" {
+			hour += 12
+		}
+	}
+	return hour, minute, hour <= 23 && minute <= 59
+}
+
+func isNumber(word string) bool {
+	_, err := strconv.Atoi(word)
+	return err == nil
+}
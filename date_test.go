@@ -0,0 +1,84 @@
+package todo
+
+import (
+	"testing"
+	"time"
+)
+
+func testDay(year int, month time.Month, day, hour, minute int) time.Time {
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseDateTime(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    time.Time
+		hasTime bool
+	}{
+		{"today", testDay(2026, 10, 18, 0, 0), false},
+		{"tomorrow", testDay(2026, 10, 19, 0, 0), false},
+		{"yesterday", testDay(2026, 10, 17, 0, 0), false},
+		{"friday", testDay(2026, 10, 23, 0, 0), false},
+		// A weekday on its own is never today
+		{"sunday", testDay(2026, 10, 25, 0, 0), false},
+		{"next fri", testDay(2026, 10, 23, 0, 0), false},
+		{"this sunday", testDay(2026, 10, 18, 0, 0), false},
+		{"last monday", testDay(2026, 10, 12, 0, 0), false},
+		{"in 3 days", testDay(2026, 10, 21, 0, 0), false},
+		{"2 weeks", testDay(2026, 11, 1, 0, 0), false},
+		{"a week ago", testDay(2026, 10, 11, 0, 0), false},
+		{"next month", testDay(2026, 11, 18, 0, 0), false},
+		{"end of week", testDay(2026, 10, 18, 0, 0), false},
+		{"end of month", testDay(2026, 10, 31, 0, 0), false},
+		{"end of year", testDay(2026, 12, 31, 0, 0), false},
+		// Without a year, the next time it comes around
+		{"oct 18", testDay(2026, 10, 18, 0, 0), false},
+		{"jan 5", testDay(2027, 1, 5, 0, 0), false},
+		{"jan 5th 2027", testDay(2027, 1, 5, 0, 0), false},
+		{"5 january 2028", testDay(2028, 1, 5, 0, 0), false},
+		{"feb 29", testDay(2028, 2, 29, 0, 0), false},
+		{"29 feb 2028", testDay(2028, 2, 29, 0, 0), false},
+		{"2026/10/20", testDay(2026, 10, 20, 0, 0), false},
+		{"2026-10-20", testDay(2026, 10, 20, 0, 0), false},
+		{"2026-10-20T09:30", testDay(2026, 10, 20, 9, 30), true},
+		{"15:30", testDay(2026, 10, 18, 15, 30), true},
+		{"3pm", testDay(2026, 10, 18, 15, 0), true},
+		{"9 am", testDay(2026, 10, 18, 9, 0), true},
+		{"tomorrow at noon", testDay(2026, 10, 19, 12, 0), true},
+		{"on friday at 8:15pm", testDay(2026, 10, 23, 20, 15), true},
+		{"now", testDay(2026, 10, 18, 15, 4), true},
+	}
+	for _, test := range tests {
+		got, hasTime, err := ParseDateTime(test.text, testClock.Now())
+		if err != nil {
+			t.Errorf("ParseDateTime(%q): %v", test.text, err)
+			continue
+		}
+		if !got.Equal(test.want) || hasTime != test.hasTime {
+			t.Errorf("ParseDateTime(%q) = %v, %v, want %v, %v",
+				test.text, got, hasTime, test.want, test.hasTime)
+		}
+	}
+}
+
+func TestParseDateTimeErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"someday",
+		"2026/02/30",
+		"2026/13/01",
+		"feb 30",
+		"31 april",
+		"feb 29 2027",
+		"2026-10-20t25:00",
+		"today tomorrow",
+		"end of",
+		"end of decade",
+		"next blue",
+		"jan",
+	} {
+		if got, _, err := ParseDateTime(text, testClock.Now()); err == nil {
+			t.Errorf("ParseDateTime(%q) = %v, want an error", text, got)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package todo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Determines if the task is waiting on another task that isn't done yet.
+// Only known for tasks from TaskManager.GetTasks.
+func (task Task) Blocked() bool {
+	return task.blocked
+}
+
+// Marks blocked tasks, e.g. " (blocked)".
+func (task Task) blockedMarker() string {
+	if !task.blocked {
+		return ""
+	}
+	return " (blocked)"
+}
+
+// Works out which of the tasks are blocked, given every open task.
+func (tasks Tasks) markBlocked(open Tasks) {
+	ids := make(map[string]bool)
+	for _, task := range open {
+		ids[task.ID] = true
+	}
+	for i := range tasks {
+		tasks[i].blocked = false
+		for _, id := range tasks[i].BlockedBy {
+			if ids[id] {
+				tasks[i].blocked = true
+			}
+		}
+	}
+}
+
+// The tasks that aren't blocked.
+func (tasks_ Tasks) FilterTasksUnblocked() Tasks {
+	tasks := make(Tasks, 0)
+	for _, task := range tasks_ {
+		if !task.blocked {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// Stops the task waiting on another one.
+func (task *Task) unblock(id string) {
+	var blockedBy []string
+	for _, blocker := range task.BlockedBy {
+		if blocker != id {
+			blockedBy = append(blockedBy, blocker)
+		}
+	}
+	task.BlockedBy = blockedBy
+	if len(blockedBy) == 0 {
+		task.blocked = false
+	}
+}
+
+// Stops the tasks waiting on another one.
+func (tasks Tasks) unblock(id string) {
+	for i := range tasks {
+		if hasTag(tasks[i].BlockedBy, id) {
+			tasks[i].unblock(id)
+		}
+	}
+}
+
+// Stops the tasks waiting on a task from waiting on it, as part of the
+// transaction that completes or deletes it. The store should be locked.
+func (manager *TaskManager) unblockDependents(tx *Transaction, id string) error {
+	stored, err := manager.store().ListTasks()
+	if err != nil && !IsCorrupt(err) {
+		return err
+	}
+dependents:
+	for _, task := range stored {
+		if !hasTag(task.BlockedBy, id) {
+			continue
+		}
+		// It may already be changing
+		for i := range tx.Put {
+			if tx.Put[i].ID == task.ID {
+				tx.Put[i].unblock(id)
+				continue dependents
+			}
+		}
+		for _, deleted := range tx.Delete {
+			if deleted.ID == task.ID {
+				continue dependents
+			}
+		}
+		unblocked := task
+		unblocked.unblock(id)
+		tx.Delete = append(tx.Delete, task)
+		tx.Put = append(tx.Put, unblocked)
+	}
+	return nil
+}
+
+// Makes sure no task the transaction changes ends up waiting on itself,
+// however indirectly. The store should be locked.
+func (manager *TaskManager) checkDependencies(tx Transaction) error {
+	stored, err := manager.store().ListTasks()
+	if err != nil && !IsCorrupt(err) {
+		return err
+	}
+	// What the store will have once the transaction is committed
+	after := make(map[string]Task)
+	for _, task := range stored {
+		after[task.ID] = task
+	}
+	for _, task := range tx.Delete {
+		delete(after, task.ID)
+	}
+	for _, task := range tx.Put {
+		after[task.ID] = task
+	}
+
+	// Tasks not in here haven't been visited yet
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visiting:
+			start := len(path) - 1
+			for path[start] != id {
+				start--
+			}
+			var bodies []string
+			for _, waiting := range append(path[start:], id) {
+				bodies = append(bodies, fmt.Sprintf("\"%s\"", after[waiting].BodyContent))
+			}
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(bodies, " waits on "))
+		case visited:
+			return nil
+		}
+		task, exists := after[id]
+		if !exists {
+			return nil
+		}
+		state[id] = visiting
+		path = append(path, id)
+		for _, blocker := range task.BlockedBy {
+			if err := visit(blocker); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		return nil
+	}
+	for _, task := range tx.Put {
+		if err := visit(task.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The tasks' dependencies as a Graphviz DOT graph, each task pointing to
+// the tasks waiting on it. Only tasks with dependencies are included.
+// Blocked tasks are dashed.
+func (tasks Tasks) DependencyGraph() string {
+	byID := make(map[string]Task)
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	linked := make(map[string]bool)
+	var edges []string
+	for _, task := range tasks {
+		for _, blocker := range task.BlockedBy {
+			if _, exists := byID[blocker]; !exists {
+				continue
+			}
+			linked[blocker], linked[task.ID] = true, true
+			edges = append(edges, fmt.Sprintf("\t%s -> %s;", dotQuote(blocker), dotQuote(task.ID)))
+		}
+	}
+	var graph strings.Builder
+	graph.WriteString("digraph todo {\n")
+	graph.WriteString("\tnode [shape=box];\n")
+	for _, task := range tasks {
+		if !linked[task.ID] {
+			continue
+		}
+		label := fmt.Sprintf("%s: %s", task.index, strings.TrimSuffix(task.BodyContent, "\n"))
+		style := ""
+		if task.blocked {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&graph, "\t%s [label=%s%s];\n", dotQuote(task.ID), dotQuote(label), style)
+	}
+	for _, edge := range edges {
+		graph.WriteString(edge + "\n")
+	}
+	graph.WriteString("}\n")
+	return graph.String()
+}
+
+// Quotes a DOT ID.
+func dotQuote(text string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(text) + "\""
+}
@@ -0,0 +1,123 @@
+package todo
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Saves tasks with the bodies, returning them by body.
+func saveTestTasks(t *testing.T, manager *TaskManager, bodies ...string) map[string]Task {
+	tasks := make(map[string]Task)
+	for _, body := range bodies {
+		task := testTask(t, body, "")
+		if err := manager.SaveTask(&task); err != nil {
+			t.Fatal(err)
+		}
+		tasks[body] = task
+	}
+	return tasks
+}
+
+// The task, waiting on the others.
+func blockedBy(task Task, blockers ...Task) Task {
+	task.BlockedBy = nil
+	for _, blocker := range blockers {
+		task.BlockedBy = append(task.BlockedBy, blocker.ID)
+	}
+	return task
+}
+
+func TestCheckDependencies(t *testing.T) {
+	manager := &TaskManager{Store: NewMemoryStore(), Clock: testClock}
+	tasks := saveTestTasks(t, manager, "a", "b", "c")
+	a, b, c := tasks["a"], tasks["b"], tasks["c"]
+	// Already stored: b waits on c
+	if err := manager.store().PutTask(blockedBy(b, c)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		tx    Transaction
+		cycle string
+	}{
+		{"waiting on another", Transaction{Put: Tasks{blockedBy(a, b)}}, ""},
+		{"waiting on two", Transaction{Put: Tasks{blockedBy(a, b, c)}}, ""},
+		{"waiting on itself", Transaction{Put: Tasks{blockedBy(a, a)}}, `"a" waits on "a"`},
+		{"waiting on each other", Transaction{Put: Tasks{blockedBy(c, b)}}, `"c" waits on "b" waits on "c"`},
+		{"waiting in a circle", Transaction{Put: Tasks{blockedBy(a, b), blockedBy(c, a)}},
+			`"a" waits on "b" waits on "c" waits on "a"`},
+		// b no longer waits on c once the transaction is done
+		{"replacing the link", Transaction{Delete: Tasks{b}, Put: Tasks{blockedBy(b), blockedBy(c, b)}}, ""},
+		{"on a deleted task", Transaction{Delete: Tasks{c}, Put: Tasks{blockedBy(a, c)}}, ""},
+	}
+	for _, test := range tests {
+		err := manager.checkDependencies(test.tx)
+		if test.cycle == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrDependencyCycle) {
+			t.Errorf("%s: got %v, want %v", test.name, err, ErrDependencyCycle)
+		} else if !strings.HasSuffix(err.Error(), test.cycle) {
+			t.Errorf("%s: got %q, want it to end %q", test.name, err, test.cycle)
+		}
+	}
+}
+
+func TestBlockedTasks(t *testing.T) {
+	manager := &TaskManager{Store: NewMemoryStore(), Clock: testClock}
+	tasks := saveTestTasks(t, manager, "paint walls", "buy paint", "hang pictures")
+	paint, walls, pictures := tasks["buy paint"], tasks["paint walls"], tasks["hang pictures"]
+	for _, task := range []Task{blockedBy(walls, paint), blockedBy(pictures, walls, paint)} {
+		if err := manager.store().PutTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocked := func() []string {
+		tasks, err := manager.GetTasks()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var bodies []string
+		for _, task := range tasks {
+			if task.Blocked() {
+				bodies = append(bodies, task.BodyContent)
+			}
+		}
+		return bodies
+	}
+	got := blocked()
+	sort.Strings(got)
+	if want := []string{"hang pictures", "paint walls"}; !equalStrings(got, want) {
+		t.Errorf("blocked %v, want %v", got, want)
+	}
+
+	// Done with the paint: what waited on it stops waiting
+	unlock, err := manager.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := Transaction{Delete: Tasks{paint}}
+	if err := manager.unblockDependents(&tx, paint.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Commit(tx); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if got, want := blocked(), []string{"hang pictures"}; !equalStrings(got, want) {
+		t.Errorf("once the paint's bought, blocked %v, want %v", got, want)
+	}
+	stored, err := manager.store().GetTask(pictures.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.BlockedBy) != 1 || stored.BlockedBy[0] != walls.ID {
+		t.Errorf("pictures wait on %v, want only the walls", stored.BlockedBy)
+	}
+}
@@ -0,0 +1,40 @@
+package todo
+
+import (
+	"strings"
+)
+
+// Splits the text of a task into its body, the first line, and its
+// description, whatever follows. Blank lines between them and trailing
+// blank lines are dropped, the description is otherwise kept as written.
+func SplitTaskText(text string) (string, string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	body, description, _ := strings.Cut(strings.TrimLeft(text, "\n"), "\n")
+	lines := strings.Split(strings.TrimRight(description, " \t\n"), "\n")
+	for len(lines) != 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	return strings.TrimSpace(body), strings.Join(lines, "\n")
+}
+
+// The task's body and description as one text, a blank line between them,
+// the way SplitTaskText reads them, e.g. to edit.
+func (task Task) Text() string {
+	if task.Description == "" {
+		return task.BodyContent
+	}
+	return task.BodyContent + "\n\n" + task.Description
+}
+
+// Marks tasks that have a description, which long listings show.
+func (task Task) descriptionMarker() string {
+	if task.Description == "" {
+		return ""
+	}
+	return " ✎"
+}
+
+// The description, wrapped and indented to line up with the task's body.
+func (task Task) FormatDescription() string {
+	return HardWrapString(task.Description, bodyLength(), "", 10, "", "")
+}
@@ -0,0 +1,66 @@
+package todo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitTaskText(t *testing.T) {
+	tests := []struct {
+		text, body, description string
+	}{
+		{"paint the wall", "paint the wall", ""},
+		{"paint the wall\n\nthe blue one\n  not the green\n\n", "paint the wall", "the blue one\n  not the green"},
+		{"\r\npaint the wall\r\nthe blue one", "paint the wall", "the blue one"},
+		{"  paint the wall  \n", "paint the wall", ""},
+	}
+	for _, test := range tests {
+		body, description := SplitTaskText(test.text)
+		if body != test.body || description != test.description {
+			t.Errorf("SplitTaskText(%q) = %q, %q, want %q, %q",
+				test.text, body, description, test.body, test.description)
+		}
+	}
+	// Text is what SplitTaskText reads back
+	task := Task{BodyContent: "paint the wall", Description: "the blue one\n\nor green"}
+	if body, description := SplitTaskText(task.Text()); body != task.BodyContent || description != task.Description {
+		t.Errorf("SplitTaskText(Text()) = %q, %q, want %q, %q",
+			body, description, task.BodyContent, task.Description)
+	}
+}
+
+func TestWrapLines(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"paint the wall", 20, []string{"paint the wall"}},
+		{"paint the wall blue", 10, []string{"paint the", "wall blue"}},
+		// Newlines are kept, as are the spaces indenting a line
+		{"paint\n  the wall", 20, []string{"paint", "  the wall"}},
+		{"abcdefghijkl", 5, []string{"abcde", "fghij", "kl"}},
+		// Wide characters take two columns
+		{"漢字漢字", 4, []string{"漢字", "漢字"}},
+	}
+	for _, test := range tests {
+		if got := wrapLines(test.text, test.width); !equalStrings(got, test.want) {
+			t.Errorf("wrapLines(%q, %d) = %q, want %q", test.text, test.width, got, test.want)
+		}
+	}
+}
+
+func TestFormatDescription(t *testing.T) {
+	setTestDisplay(t, Display{Width: 64})
+	task := Task{BodyContent: "paint the wall",
+		Description: "the blue one from the shop on the corner\nnot the green"}
+	// Bodies are 20 columns wide at this width, the first line padded out
+	indent := strings.Repeat(" ", 10)
+	want := indent + "the blue one from   \n" +
+		indent + "the shop on the\n" +
+		indent + "corner\n" +
+		indent + "not the green"
+	if got := task.FormatDescription(); got != want {
+		t.Errorf("FormatDescription() =\n%s\nwant\n%s", got, want)
+	}
+}
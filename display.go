@@ -4,22 +4,102 @@ import (
 	"fmt"
 	"os"
 	"strings"
-	"time"
+	"sync"
+
+	"github.com/mattn/go-runewidth"
 )
 
 const (
-	GREY  = "\x1b[90m"
-	RED   = "\x1b[31m"
-	GREEN = "\x1b[32m"
-	RESET = "\x1b[37m"
+	GREY   = "\x1b[90m"
+	RED    = "\x1b[31m"
+	GREEN  = "\x1b[32m"
+	YELLOW = "\x1b[33m"
+	// Puts text back to how the terminal had it
+	RESET = "\x1b[0m"
+	// Search matches
+	HIGHLIGHT = "\x1b[93m"
 )
 
+// How many columns output fits in when the terminal's width isn't known.
+const DEFAULT_WIDTH = 104
+
+// Task bodies get what's left of the width after the index before them and
+// the category, days left and markers after them.
+const BODY_MARGIN = 44
+
+// Task bodies are never wrapped narrower than this.
+const MIN_BODY_LENGTH = 20
+
+// How output is shown, see SetDisplay.
+type Display struct {
+	// How many columns the terminal has, 0 being DEFAULT_WIDTH.
+	Width int
+	// Whether to colour output at all, e.g. not when NO_COLOR is set or
+	// output isn't a terminal.
+	Colors bool
+	// The same for messages logged to stderr, which can be a terminal
+	// when output isn't, or the other way around.
+	LogColors bool
+	Theme     Theme
+}
+
+var (
+	display = Display{Width: DEFAULT_WIDTH, Colors: true, LogColors: true, Theme: DEFAULT_THEME}
+	// The website renders pages for many requests at once
+	displayLock sync.RWMutex
+)
+
+// Changes how output is shown from then on.
+func SetDisplay(newDisplay Display) {
+	if newDisplay.Width <= 0 {
+		newDisplay.Width = DEFAULT_WIDTH
+	}
+	displayLock.Lock()
+	defer displayLock.Unlock()
+	display = newDisplay
+}
+
+// How output is shown right now, see SetDisplay.
+func currentDisplay() Display {
+	displayLock.RLock()
+	defer displayLock.RUnlock()
+	return display
+}
+
+// How many columns task bodies are wrapped to, to fit the width.
+func bodyLength() int {
+	if length := currentDisplay().Width - BODY_MARGIN; length > MIN_BODY_LENGTH {
+		return length
+	}
+	return MIN_BODY_LENGTH
+}
+
+// Colours each line of the text, if output is coloured.
+func colorize(color Color, text string) string {
+	return colorizeIf(currentDisplay().Colors, color, text)
+}
+
+func colorizeIf(colors bool, color Color, text string) string {
+	if !colors || color == "" {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = string(color) + line + RESET
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func LogSuccess(s string) {
-	fmt.Fprintf(os.Stderr, GREEN+s+RESET+"\n")
+	display := currentDisplay()
+	fmt.Fprint(os.Stderr, colorizeIf(display.LogColors, display.Theme.Success, s)+"\n")
 }
 
 func LogError(s string) {
-	fmt.Fprintf(os.Stderr, RED+s+RESET+"\n")
+	display := currentDisplay()
+	fmt.Fprint(os.Stderr, colorizeIf(display.LogColors, display.Theme.Error, s)+"\n")
 }
 
 /// Displays tasks in the "Short" form. Just a list of unique hashes and
@@ -38,6 +118,7 @@ func DisplayTasksLong(tasks Tasks) {
 	if len(tasks) == 0 {
 		return
 	}
+	display := currentDisplay()
 	// NOTE This is the first day because it's assumed to be sorted.
 	curDay := tasks[0].DueDate
 	printed := false
@@ -45,15 +126,28 @@ func DisplayTasksLong(tasks Tasks) {
 		if !printed || !is_same_day(curDay, task.DueDate) {
 			printed = true
 			curDay = task.DueDate
-			dayHeader := fmt.Sprintf("%-90v%v\n",
-				curDay.Format("Monday")+":",
-				curDay.Format(EXPLICIT_TIME_FORMAT))
-			if task.DueAfter(time.Now().AddDate(0, 0, 6)) {
-				dayHeader = GREY + dayHeader + RESET
+			date := curDay.Format(EXPLICIT_TIME_FORMAT)
+			dayHeader := padRight(curDay.Format("Monday")+":", display.Width-len(date)) + date
+			if task.DueAfter(task.now().AddDate(0, 0, 6)) {
+				dayHeader = colorize(display.Theme.Greyed, dayHeader)
 			}
-			fmt.Printf(dayHeader)
+			fmt.Println(dayHeader)
 		}
 		fmt.Println(task.FormatTask())
+		if task.Description != "" {
+			description := task.FormatDescription()
+			if task.DueAfter(task.now().AddDate(0, 0, 6)) {
+				description = colorize(display.Theme.Greyed, description)
+			}
+			fmt.Println(description)
+		}
+		if len(task.Checklist) != 0 {
+			checklist := task.FormatChecklist()
+			if task.DueAfter(task.now().AddDate(0, 0, 6)) {
+				checklist = colorize(display.Theme.Greyed, checklist)
+			}
+			fmt.Println(checklist)
+		}
 	}
 }
 
@@ -62,43 +156,68 @@ func DisplayTasksLong(tasks Tasks) {
 ///
 /// Each paragraph will be indented at least preamble_length amount.
 /// Pre-amble will be on the first line only.
+///
+/// Lengths are in terminal columns, so wide characters such as CJK and
+/// emoji take up two. Newlines in the paragraph are kept.
 func HardWrapString(paragraph string, maxLength int,
 	preamblePart string, preambleLength int,
 	postamble string, everyLinePreamble string) string {
-	append_header := func(body string) string {
-		return fmt.Sprintf("%-*s%-*v%s",
-			preambleLength,
-			preamblePart,
-			maxLength,
-			body,
-			postamble)
-	}
-
-	preamble := fmt.Sprintf("%*s", preambleLength, everyLinePreamble)
-
-	if len(paragraph) < maxLength {
-		return append_header(paragraph)
+	lines := wrapLines(paragraph, maxLength-1)
+	preamble := padLeft(everyLinePreamble, preambleLength)
+	result := padRight(preamblePart, preambleLength) + padRight(lines[0], maxLength) + postamble
+	for _, line := range lines[1:] {
+		result += "\n" + preamble + line
 	}
+	return result
+}
 
-	words := strings.Split(paragraph, " ")
-	first := true
-	result := ""
-	buffer := ""
-	for _, word := range words {
-		if len(buffer)+len(word)+1 > CONTENT_LENGTH {
-			if first {
-				result = append_header(buffer)
-				first = false
-			} else {
-				result += "\n" + preamble + buffer
+/// Splits text into lines at most width columns wide, breaking at spaces
+/// where it can and keeping the newlines already in it.
+func wrapLines(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for i, word := range strings.Split(paragraph, " ") {
+			if line != "" && displayWidth(line)+1+displayWidth(word) > width {
+				lines = append(lines, line)
+				line = ""
+			} else if i != 0 {
+				// Keeps runs of spaces, e.g. indenting
+				line += " "
+			}
+			// Words too long for a line of their own are broken up
+			for displayWidth(word) > width {
+				head := runewidth.Truncate(word, width, "")
+				if head == "" {
+					break
+				}
+				lines = append(lines, line+head)
+				line, word = "", strings.TrimPrefix(word, head)
 			}
-			buffer = ""
+			line += word
 		}
-		buffer += word + " "
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+/// How many terminal columns the text takes up.
+func displayWidth(text string) int {
+	return runewidth.StringWidth(text)
+}
+
+/// Pads the text with spaces on the right to width columns.
+func padRight(text string, width int) string {
+	if padding := width - displayWidth(text); padding > 0 {
+		return text + strings.Repeat(" ", padding)
 	}
+	return text
+}
 
-	if len(buffer) != 0 {
-		result += "\n" + preamble + buffer
+/// Pads the text with spaces on the left to width columns.
+func padLeft(text string, width int) string {
+	if padding := width - displayWidth(text); padding > 0 {
+		return strings.Repeat(" ", padding) + text
 	}
-	return result
+	return text
 }
@@ -0,0 +1,88 @@
+package todo
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Sets how output is shown for the rest of the test.
+func setTestDisplay(t *testing.T, newDisplay Display) {
+	old := currentDisplay()
+	SetDisplay(newDisplay)
+	t.Cleanup(func() { SetDisplay(old) })
+}
+
+// The website changes how output is shown while other requests are being
+// rendered, which go test -race checks.
+func TestDisplayConcurrent(t *testing.T) {
+	setTestDisplay(t, Display{Colors: true, Theme: DEFAULT_THEME})
+	task := testTask(t, "paint the wall", "")
+	task.clock = testClock
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			SetDisplay(Display{Width: 80 + i, Colors: i%2 == 0, Theme: DEFAULT_THEME})
+		}()
+		go func() {
+			defer wg.Done()
+			task.FormatTask()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFormatTaskColors(t *testing.T) {
+	theme := Theme{Overdue: RED, DueToday: GREEN, Greyed: GREY}
+	overdue := testTask(t, "paint the wall", "")
+	overdue.clock = FixedClock{Time: time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)}
+	today := testTask(t, "paint the door", "")
+	today.clock = testClock
+	tests := []struct {
+		display Display
+		task    Task
+		want    string
+	}{
+		{Display{Colors: true, Theme: theme}, overdue, RED + overdue.String() + RESET},
+		{Display{Colors: true, Theme: theme}, today, GREEN + today.String() + RESET},
+		// Without colours, e.g. with NO_COLOR set, output is left plain
+		{Display{Colors: false, Theme: theme}, overdue, overdue.String()},
+		// As it is when the theme has no colour for the task
+		{Display{Colors: true, Theme: Theme{Overdue: RED}}, today, today.String()},
+	}
+	for _, test := range tests {
+		setTestDisplay(t, test.display)
+		if got := test.task.FormatTask(); got != test.want {
+			t.Errorf("FormatTask() of %q with %+v = %q, want %q",
+				test.task.BodyContent, test.display, got, test.want)
+		}
+	}
+}
+
+func TestColorizeLines(t *testing.T) {
+	got := colorizeIf(true, RED, "paint\n\nthe wall")
+	want := RED + "paint" + RESET + "\n\n" + RED + "the wall" + RESET
+	if got != want {
+		t.Errorf("colorizeIf() = %q, want %q", got, want)
+	}
+}
+
+func TestBodyLength(t *testing.T) {
+	tests := []struct {
+		width int
+		want  int
+	}{
+		{DEFAULT_WIDTH, DEFAULT_WIDTH - BODY_MARGIN},
+		{120, 120 - BODY_MARGIN},
+		// Narrow terminals still leave bodies room
+		{50, MIN_BODY_LENGTH},
+	}
+	for _, test := range tests {
+		setTestDisplay(t, Display{Width: test.width})
+		if got := bodyLength(); got != test.want {
+			t.Errorf("bodyLength() at width %d = %d, want %d", test.width, got, test.want)
+		}
+	}
+}
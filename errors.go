@@ -0,0 +1,68 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrTaskExists     = errors.New("You have already made that a task")
+	ErrTaskNotFound   = errors.New("No such task")
+	ErrAmbiguousIndex = errors.New("Index matches more than one task")
+	ErrTaskChanged    = errors.New("Task was changed since it was read")
+	ErrCorruptTask    = errors.New("Corrupt task")
+
+	ErrCategoryNotFound = errors.New("No such category")
+	ErrCategoryExists   = errors.New("Category already exists")
+	ErrCategoryNotEmpty = errors.New("Category still has tasks")
+
+	ErrDependencyCycle = errors.New("Tasks would wait on each other")
+)
+
+// A task that could not be read. Matches ErrCorruptTask with errors.Is.
+type CorruptTaskError struct {
+	// The file the task was read from. For stores that aren't backed by
+	// files this is the task's index instead.
+	Path string
+	Err  error
+}
+
+func (err *CorruptTaskError) Error() string {
+	return fmt.Sprintf("Corrupt task \"%s\": %v", err.Path, err.Err)
+}
+
+func (err *CorruptTaskError) Unwrap() error {
+	return err.Err
+}
+
+func (err *CorruptTaskError) Is(target error) bool {
+	return target == ErrCorruptTask
+}
+
+// Returned by listings alongside the tasks that could be read, so one bad
+// task doesn't hide all the others.
+type CorruptTasksError []*CorruptTaskError
+
+func (errs CorruptTasksError) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (errs CorruptTasksError) Is(target error) bool {
+	return target == ErrCorruptTask
+}
+
+// Determines if an error only reports corrupt tasks that were skipped.
+func IsCorrupt(err error) bool {
+	var corrupt CorruptTasksError
+	return errors.As(err, &corrupt)
+}
+
+// An index that doesn't pick out exactly one task.
+func indexError(index string, err error) error {
+	return fmt.Errorf("Bad index \"%s\": %w", index, err)
+}
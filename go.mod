@@ -1,8 +1,24 @@
 module git.sr.ht/~timidger/todo
 
-go 1.12
+go 1.23.0
 
 require (
 	git.sr.ht/~sircmpwn/getopt v0.0.0-20190609193657-e7e23d1cd3a3
-	github.com/mattn/go-isatty v0.0.7
+	github.com/mattn/go-isatty v0.0.24
+	github.com/mattn/go-runewidth v0.0.28
+	golang.org/x/term v0.32.0
+	modernc.org/sqlite v1.38.2
+)
+
+require (
+	github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/ncruces/go-strftime v1.0.0 // indirect
+	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
+	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
+	golang.org/x/sys v0.34.0 // indirect
+	modernc.org/libc v1.66.7 // indirect
+	modernc.org/mathutil v1.7.1 // indirect
+	modernc.org/memory v1.12.1 // indirect
 )
@@ -0,0 +1,53 @@
+package todo
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const CROCKFORD_BASE32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Tasks made before tasks had IDs were named after the SHA-1 of their
+// contents, that name is now their ID.
+var legacyID = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// Makes a new, unique, task ID. IDs are ULIDs: a millisecond timestamp
+// followed by 80 random bits, written in Crockford's base32.
+func NewID() string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixNano()/int64(time.Millisecond))<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(fmt.Sprintf("Could not read random bytes: %v", err))
+	}
+	// 128 bits in 26 characters of 5 bits, the first character only
+	// gets the top 3 bits.
+	high := binary.BigEndian.Uint64(id[:8])
+	low := binary.BigEndian.Uint64(id[8:])
+	encoded := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		encoded[i] = CROCKFORD_BASE32[low&0x1f]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+	return string(encoded)
+}
+
+// The full index shown for a task. Derived from the ID, but hashed so the
+// condensed indices are short even though IDs made around the same time
+// all start with the same characters.
+func indexFromID(id string) string {
+	if legacyID.MatchString(id) {
+		return id
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(id)))
+}
+
+// Sets the indices of a task that was just read from a store.
+func (task *Task) setIndex() {
+	task.fullIndex = indexFromID(task.ID)
+	task.index = task.fullIndex
+}
@@ -0,0 +1,255 @@
+package todo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+const JOURNAL = "journal"
+
+// A group of changes that should either all happen or not at all, e.g.
+// completing a repeating task removes it, saves the next occurrence and
+// logs it in the audit log.
+//
+// Deletes are applied before puts, so a task can be replaced by deleting
+// and putting it in the same transaction.
+type Transaction struct {
+	Delete  Tasks
+	Put     Tasks
+	Records Records
+}
+
+// A task as written in the journal. The category isn't part of a task's
+// JSON so it is kept alongside it.
+type journalTask struct {
+	Category string
+	Task     Task
+}
+
+// The journal of a DirectoryStore transaction, written before any of the
+// changes are made and removed once all of them have been made.
+type journal struct {
+	Delete  []journalTask
+	Put     []journalTask
+	Records []journalRecord
+	// The size of each category's audit log before the transaction.
+	// Replaying truncates back to it, so records aren't logged twice.
+	AuditLogSizes map[string]int64
+}
+
+type journalRecord struct {
+	Category string
+	Fields   []string
+}
+
+func toJournalTasks(tasks Tasks) []journalTask {
+	journalTasks := make([]journalTask, len(tasks))
+	for i, task := range tasks {
+		journalTasks[i] = journalTask{task.Category(), task}
+	}
+	return journalTasks
+}
+
+func (journalTask journalTask) task() Task {
+	task := journalTask.Task
+	task.setIndex()
+	if journalTask.Category != "" {
+		category := journalTask.Category
+		task.category = &category
+	}
+	return task
+}
+
+func (store *DirectoryStore) journalPath() string {
+	return path.Join(store.Root, JOURNAL)
+}
+
+func (store *DirectoryStore) Commit(tx Transaction) error {
+	var journal journal
+	journal.Delete = toJournalTasks(tx.Delete)
+	journal.Put = toJournalTasks(tx.Put)
+	journal.AuditLogSizes = make(map[string]int64)
+	for _, record := range tx.Records {
+		journal.Records = append(journal.Records,
+			journalRecord{record.Category, record.Marshal()})
+		if _, exists := journal.AuditLogSizes[record.Category]; exists {
+			continue
+		}
+		auditLogPath := path.Join(store.categoryDir(record.Category), AUDIT_LOG)
+		info, err := os.Stat(auditLogPath)
+		if err == nil {
+			journal.AuditLogSizes[record.Category] = info.Size()
+		} else if os.IsNotExist(err) {
+			journal.AuditLogSizes[record.Category] = 0
+		} else {
+			return err
+		}
+	}
+
+	journalJson, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	if err := createDir(store.Root); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(store.journalPath(), journalJson); err != nil {
+		return err
+	}
+	return store.replay(journal)
+}
+
+// Finishes a transaction that was interrupted, if there is one. The store
+// should be locked, as nothing else can be committing then.
+func (store *DirectoryStore) recoverLocked() error {
+	journalJson, err := ioutil.ReadFile(store.journalPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var journal journal
+	if err := json.Unmarshal(journalJson, &journal); err != nil {
+		// The journal is written atomically so this shouldn't happen,
+		// but if it does none of its changes were made yet.
+		LogError("Discarding unreadable journal: " + err.Error())
+		return os.Remove(store.journalPath())
+	}
+	// The records may not have made it into the search index
+	if len(journal.Records) != 0 {
+		if err := store.WriteMeta(SEARCH_INDEX, nil); err != nil {
+			return err
+		}
+	}
+	return store.replay(journal)
+}
+
+// Makes every change in the journal, then removes it. Safe to run more
+// than once for the same journal.
+func (store *DirectoryStore) replay(journal journal) error {
+	for _, journalTask := range journal.Delete {
+		err := os.Remove(store.taskPath(journalTask.task()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for _, journalTask := range journal.Put {
+		if err := store.PutTask(journalTask.task()); err != nil {
+			return err
+		}
+	}
+	for category, size := range journal.AuditLogSizes {
+		auditLogPath := path.Join(store.categoryDir(category), AUDIT_LOG)
+		info, err := os.Stat(auditLogPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if info.Size() > size {
+			if err := os.Truncate(auditLogPath, size); err != nil {
+				return err
+			}
+		}
+	}
+	for _, record := range journal.Records {
+		if err := store.appendFields(record.Category, record.Fields); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(store.journalPath()); err != nil {
+		return err
+	}
+	return syncDir(store.Root)
+}
+
+// Writes a file by writing a temporary file next to it and renaming it
+// into place, so the file is never seen half written.
+func writeFileAtomic(fileName string, data []byte) error {
+	dir := path.Dir(fileName)
+	temp, err := ioutil.TempFile(dir, "."+path.Base(fileName)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), fileName); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// Flushes a directory's entries, so renames and removals in it survive a
+// crash.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+func (store *MemoryStore) Commit(tx Transaction) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, task := range tx.Delete {
+		delete(store.tasks, task.ID)
+	}
+	for _, task := range tx.Put {
+		if task.Category() != "" {
+			store.categories[task.Category()] = true
+		}
+		store.tasks[task.ID] = copyTask(task)
+	}
+	for _, record := range tx.Records {
+		if record.Category != "" {
+			store.categories[record.Category] = true
+		}
+		store.records = append(store.records, record)
+	}
+	return nil
+}
+
+func (store *SQLiteStore) Commit(tx Transaction) (err error) {
+	sqlTx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			sqlTx.Rollback()
+		}
+	}()
+	for _, task := range tx.Delete {
+		if err := deleteSQLiteTask(sqlTx, task); err != nil {
+			return err
+		}
+	}
+	for _, task := range tx.Put {
+		if err := putSQLiteTask(sqlTx, task); err != nil {
+			return err
+		}
+	}
+	for _, record := range tx.Records {
+		if err := appendSQLiteRecord(sqlTx, record); err != nil {
+			return err
+		}
+	}
+	return sqlTx.Commit()
+}
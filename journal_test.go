@@ -0,0 +1,96 @@
+package todo
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+)
+
+// A commit interrupted part way through is finished the next time the
+// store is locked, without logging its records twice.
+func TestJournalRecovery(t *testing.T) {
+	root := t.TempDir()
+	store := NewDirectoryStore(root)
+	task := testTask(t, "water plants", "home")
+	if err := store.CreateCategory("home"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutTask(task); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AppendRecord(NewRecord(task, testClock.Now().AddDate(0, 0, -7), "")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Completing the task, which got as far as logging it before stopping
+	next := task
+	next.DueDate = task.DueDate.AddDate(0, 0, 7)
+	record := NewRecord(task, testClock.Now(), "all of them")
+	info, err := os.Stat(path.Join(store.categoryDir("home"), AUDIT_LOG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	journalJson, err := json.Marshal(journal{
+		Delete:        toJournalTasks(Tasks{task}),
+		Put:           toJournalTasks(Tasks{next}),
+		Records:       []journalRecord{{record.Category, record.Marshal()}},
+		AuditLogSizes: map[string]int64{"home": info.Size()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(store.journalPath(), journalJson); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.appendFields(record.Category, record.Marshal()); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewDirectoryStore(root)
+	unlock, err := reopened.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if _, err := os.Stat(reopened.journalPath()); !os.IsNotExist(err) {
+		t.Errorf("the journal is still there: %v", err)
+	}
+	got, err := reopened.GetTask(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || !got.DueDate.Equal(next.DueDate) || got.Category() != "home" {
+		t.Errorf("GetTask(%s) = %v, want it due %v in home", task.ID, got, next.DueDate)
+	}
+	records, err := reopened.ListRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1].Annotation != "all of them" {
+		t.Errorf("ListRecords() = %v, want the earlier record and the replayed one", records)
+	}
+}
+
+func TestJournalUnreadable(t *testing.T) {
+	store := NewDirectoryStore(t.TempDir())
+	task := testTask(t, "water plants", "")
+	if err := store.PutTask(task); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.journalPath(), []byte("{\"Delete\": ["), 0600); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := store.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	// None of its changes were made, so there are none to undo
+	if got, err := store.GetTask(task.ID); err != nil || got == nil {
+		t.Errorf("GetTask(%s) = %v, %v, want the task untouched", task.ID, got, err)
+	}
+	if _, err := os.Stat(store.journalPath()); !os.IsNotExist(err) {
+		t.Errorf("the journal is still there: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package todo
+
+import "os"
+
+// Advisory locks aren't supported here, the file is only opened so the
+// store can be used the same way everywhere.
+func lockFile(fileName string) (*os.File, error) {
+	return os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0600)
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package todo
+
+import (
+	"os"
+	"syscall"
+)
+
+// Takes an exclusive advisory lock on a file, creating it if it doesn't
+// exist, and waits until the lock is free. The lock is held until the
+// returned file is closed.
+//
+// Every call opens the file again, so goroutines in the same process
+// exclude each other as well as other processes.
+func lockFile(fileName string) (*os.File, error) {
+	file, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
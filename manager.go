@@ -1,15 +1,11 @@
 package todo
 
 import (
-	"crypto/sha1"
-	"encoding/csv"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path"
-	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -22,24 +18,34 @@ func (tasks Tasks) Len() int {
 }
 
 func (tasks Tasks) Less(i, j int) bool {
-	if tasks[i].category != nil {
-		if tasks[j].category == nil {
-			return false
-		}
-		if tasks[j].category != nil {
-			comparison := strings.Compare(*tasks[i].category, *tasks[j].category)
-			if comparison != 0 {
-				return comparison < 0
-			}
-		}
-	} else if tasks[j].category != nil {
-		return true
+	if comparison := compareCategories(tasks[i], tasks[j]); comparison != 0 {
+		return comparison < 0
 	}
 	taskIDueDate := tasks[i].DueDate.AddDate(0, 0, tasks[i].OverdueDays)
 	taskJDueDate := tasks[j].DueDate.AddDate(0, 0, tasks[j].OverdueDays)
+	// Tasks due on the same day go by priority, then time of day
+	if days := daysBetween(taskIDueDate, taskJDueDate); days != 0 {
+		return days > 0
+	}
+	if tasks[i].Priority != tasks[j].Priority {
+		return tasks[i].Priority.Above(tasks[j].Priority)
+	}
 	return taskIDueDate.Before(taskJDueDate)
 }
 
+// Orders tasks by category, those without one first.
+func compareCategories(a, b Task) int {
+	if a.category != nil {
+		if b.category == nil {
+			return 1
+		}
+		return strings.Compare(*a.category, *b.category)
+	} else if b.category != nil {
+		return -1
+	}
+	return 0
+}
+
 func (tasks Tasks) Swap(i, j int) {
 	tasks[i], tasks[j] = tasks[j], tasks[i]
 }
@@ -69,205 +75,511 @@ condense_tasks:
 	return tasks
 }
 
-func (tasks Tasks) GetByHash(hash string) *Task {
-	for i, _ := range tasks {
-		if tasks[i].index == hash || tasks[i].fullIndex[0:len(hash)] == hash {
-			return &tasks[i]
-		}
+// A TaskManager is safe to use from several goroutines, and the store
+// it uses is locked while it's being changed.
+type TaskManager struct {
+	// Where the default DirectoryStore keeps its files.
+	StorageDirectory string
+	// Storage backend. If nil a DirectoryStore rooted at
+	// StorageDirectory is used.
+	Store Store
+	// If set, listings and new tasks are limited to this category.
+	// Archived categories are only listed if this is one of them.
+	Category string
+	// What the time is. If nil the system clock is used.
+	Clock Clock
+}
+
+func (manager *TaskManager) clock() Clock {
+	return orSystemClock(manager.Clock)
+}
+
+func (manager *TaskManager) store() Store {
+	if manager.Store == nil {
+		return NewDirectoryStore(manager.StorageDirectory)
 	}
-	return nil
+	return manager.Store
 }
 
-type TaskManager struct {
-	StorageDirectory string
+// Waits for exclusive use of the store until unlock is called. Hold the
+// lock while reading tasks and then changing them based on what was read.
+func (manager *TaskManager) Lock() (unlock func(), err error) {
+	return manager.store().Lock()
 }
 
-// Saves a new task to disk
+// Saves a new task
 func (manager *TaskManager) SaveTask(task *Task) error {
-	storageDir := manager.StorageDirectory
-	if task.category != nil && path.Base(storageDir) != *task.category {
-		storageDir = path.Join(storageDir, *task.category)
-	}
-	createDir(storageDir)
-	sha := sha1.New()
-	sha.Write([]byte(task.BodyContent))
-	// Also use the storage directory name as part of the hash,
-	// this is to avoid collisions across categories.
-	sha.Write([]byte(path.Base(storageDir)))
-	hash := fmt.Sprintf("%x", sha.Sum(nil))
-	task.fullIndex = hash
-	savePath := path.Join(storageDir, hash+".todo")
-	if _, err := os.Stat(savePath); !os.IsNotExist(err) {
-		return errors.New("You have already made that a task")
-	}
-	new, err := os.Create(savePath)
+	unlock, err := manager.Lock()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer new.Close()
-
-	taskJson, err := json.Marshal(task)
+	defer unlock()
+	manager.assignID(task)
+	existing, err := manager.store().GetTask(task.ID)
 	if err != nil {
 		return err
 	}
+	if existing != nil {
+		return ErrTaskExists
+	}
+	return manager.store().PutTask(*task)
+}
 
-	if _, err := new.Write(taskJson); err != nil {
-		return err
+// Gives a new task its category, if it doesn't have one, and its ID.
+func (manager *TaskManager) assignID(task *Task) {
+	if task.category == nil && manager.Category != "" {
+		category := manager.Category
+		task.category = &category
 	}
-	return nil
+	if task.ID == "" {
+		task.ID = NewID()
+	}
+	task.setIndex()
+	task.clock = manager.clock()
 }
 
-/// Deletes a task by index
-func (manager *TaskManager) DeleteTask(tasks Tasks, taskIndex string) *Task {
-	toDeleteIndex := -1
+// Finds the task with the given index. An exact match on the condensed
+// index wins, otherwise the index must be a prefix of exactly one full index.
+func findTask(tasks Tasks, taskIndex string) (int, error) {
 	for i, task := range tasks {
 		if taskIndex == task.index {
-			toDeleteIndex = i
-			break
+			return i, nil
 		}
 	}
 
-	// If exact match couldn't be found see if there's a unique match using
-	// the full length.
-	if toDeleteIndex == -1 {
-		for i, task := range tasks {
-			if strings.HasPrefix(task.fullIndex, taskIndex) {
-				if toDeleteIndex != -1 {
-					return nil
-				}
-				toDeleteIndex = i
+	found := -1
+	for i, task := range tasks {
+		if strings.HasPrefix(task.fullIndex, taskIndex) {
+			if found != -1 {
+				return -1, indexError(taskIndex, ErrAmbiguousIndex)
 			}
+			found = i
 		}
 	}
-	if toDeleteIndex == -1 {
-		return nil
+	if found == -1 {
+		return -1, indexError(taskIndex, ErrTaskNotFound)
 	}
+	return found, nil
+}
+
+// Gets a copy of the task with the given index.
+func (tasks Tasks) Find(taskIndex string) (*Task, error) {
+	i, err := findTask(tasks, taskIndex)
+	if err != nil {
+		return nil, err
+	}
+	task := tasks[i]
+	return &task, nil
+}
 
-	if err := os.Remove(tasks[toDeleteIndex].fileName); err != nil {
-		panic(err)
+/// Deletes a task by index
+func (manager *TaskManager) DeleteTask(tasks Tasks, taskIndex string) (*Task, error) {
+	task, err := tasks.Find(taskIndex)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := manager.Lock()
+	if err != nil {
+		return nil, err
 	}
-	task := tasks[toDeleteIndex]
-	if task.Repeat == nil {
-		tasks = append(tasks[:toDeleteIndex], tasks[toDeleteIndex+1:]...)
+	defer unlock()
+	if err := manager.CheckUnchanged(*task); err != nil {
+		return nil, err
 	}
-	return &task
+	if err := manager.store().DeleteTask(*task); err != nil {
+		return nil, err
+	}
+	return task, nil
 }
 
-func (manager *TaskManager) GetCategories() Categories {
-	createDir(manager.StorageDirectory)
-	root := manager.StorageDirectory
-	var categories Categories
-	maxDepth := strings.Count(root, "/") + 1
-	err := filepath.Walk(root,
-		func(path string, info os.FileInfo, err error) error {
-			depth := strings.Count(path, "/")
-			if path == root || depth > maxDepth {
-				return nil
-			}
-			if info.IsDir() {
-				subDirFiles, err := ioutil.ReadDir(path)
-				if err != nil {
-					return err
-				}
-				count := 0
-				for _, file := range subDirFiles {
-					var task Task
-					name := file.Name()
-					if name == "audit_log" {
-						continue
-					}
-					path := strings.Join([]string{path, name}, "/")
-					bytes, err := ioutil.ReadFile(path)
-					if err != nil {
-						continue
-					}
-					err = json.Unmarshal(bytes, &task)
-					if err != nil {
-						continue
-					}
-					if task.DueToday() {
-						count += 1
-					}
-				}
-				var category Category
-				category.Name = info.Name()
-				category.Tasks = count
-				categories = append(categories, category)
-			}
-			return nil
-		})
+// Replaces a task with a new version of it, keeping its identity.
+func (manager *TaskManager) ReplaceTask(old Task, new *Task) Transaction {
+	new.ID = old.ID
+	new.setIndex()
+	return Transaction{Delete: Tasks{old}, Put: Tasks{*new}}
+}
+
+// Makes sure a task read earlier is still stored as it was, e.g. that it
+// wasn't completed from somewhere else in the meantime. The store should
+// be locked.
+func (manager *TaskManager) CheckUnchanged(task Task) error {
+	stored, err := manager.store().GetTask(task.ID)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	sort.Sort(categories)
-	return categories
+	if stored == nil {
+		return indexError(task.index, ErrTaskNotFound)
+	}
+	// Anything about it could have changed, e.g. a checklist item checked
+	// off, so it's compared as it's stored
+	storedJson, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	taskJson, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	if stored.Category() != task.Category() || !bytes.Equal(storedJson, taskJson) {
+		return indexError(task.index, ErrTaskChanged)
+	}
+	return nil
 }
 
-func (manager *TaskManager) getTasksHelper() Tasks {
-	createDir(manager.StorageDirectory)
-	root := manager.StorageDirectory
-	var tasks Tasks
-	maxDepth := strings.Count(root, "/") + 1
-	err := filepath.Walk(root,
-		func(path string, info os.FileInfo, err error) error {
-			// Nested directories are ignored -- this is to support categories
-			// as simply "other" todo storages.
-			depth := strings.Count(path, "/")
-			if path == root || info.IsDir() || depth > maxDepth {
-				return nil
+// Moves tasks to another category, "" being no category, keeping
+// everything else about them. Either every task is moved or none are.
+func (manager *TaskManager) MoveTasks(tasks Tasks, indices []string, category string) (Tasks, error) {
+	category, err := CleanCategory(category)
+	if err != nil {
+		return nil, err
+	}
+	if category != "" {
+		exists, err := manager.CategoryExists(category)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errors.New(fmt.Sprintf("Category \"%s\" does not exist", category))
+		}
+	}
+	var tx Transaction
+	for _, index := range indices {
+		task, err := tasks.Find(index)
+		if err != nil {
+			return nil, err
+		}
+		moved, _ := TaskChanges{Category: &category}.Apply(*task)
+		tx.Delete = append(tx.Delete, *task)
+		tx.Put = append(tx.Put, moved)
+	}
+
+	unlock, err := manager.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	for _, task := range tx.Delete {
+		if err := manager.CheckUnchanged(task); err != nil {
+			return nil, err
+		}
+	}
+	if err := manager.checkMoves(tx); err != nil {
+		return nil, err
+	}
+	if err := manager.Commit(tx); err != nil {
+		return nil, err
+	}
+	return tx.Put, nil
+}
+
+// Makes sure no task the transaction moves to another category ends up
+// next to a task with the same body. The store should be locked.
+func (manager *TaskManager) checkMoves(tx Transaction) error {
+	stored, err := manager.store().ListTasks()
+	if err != nil && !IsCorrupt(err) {
+		return err
+	}
+	from := make(map[string]string)
+	for _, task := range tx.Delete {
+		from[task.ID] = task.Category()
+	}
+	// What the store will have once the transaction is committed
+	var after Tasks
+	for _, task := range stored {
+		if _, deleted := from[task.ID]; !deleted {
+			after = append(after, task)
+		}
+	}
+	after = append(after, tx.Put...)
+
+	for _, task := range tx.Put {
+		if category, exists := from[task.ID]; !exists || category == task.Category() {
+			continue
+		}
+		for _, other := range after {
+			if other.ID != task.ID && other.Category() == task.Category() &&
+				other.BodyContent == task.BodyContent {
+				return fmt.Errorf("%w: \"%s\" is already in %s", ErrTaskExists,
+					task.BodyContent, categoryName(task.Category()))
 			}
-			var task Task
-			task.fileName = path
+		}
+	}
+	return nil
+}
+
+func categoryName(category string) string {
+	if category == "" {
+		return "no category"
+	}
+	return fmt.Sprintf("\"%s\"", category)
+}
+
+// Makes every change in the transaction, or none of them. The manager
+// should be locked, see Lock.
+func (manager *TaskManager) Commit(tx Transaction) error {
+	if err := manager.store().Commit(tx); err != nil {
+		return err
+	}
+	return manager.recordsLogged(tx.Records)
+}
+
+// Keeps the search index up to date with records that were just logged.
+// The records are logged either way, so if the index can't be updated it's
+// thrown away to be built again.
+func (manager *TaskManager) recordsLogged(records Records) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := manager.indexRecords(records); err != nil {
+		return manager.dropSearchIndex()
+	}
+	return nil
+}
+
+// Creates a category, and the categories it's nested in, if they do not
+// already exist.
+func (manager *TaskManager) CreateCategory(name string) error {
+	name, err := CleanCategory(name)
+	if err != nil {
+		return err
+	}
+	for _, category := range append(parentCategories(name), name) {
+		if err := manager.store().CreateCategory(category); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Determines if a category exists.
+func (manager *TaskManager) CategoryExists(name string) (bool, error) {
+	name, err := CleanCategory(name)
+	if err != nil {
+		return false, err
+	}
+	names, err := manager.store().ListCategories()
+	if err != nil {
+		return false, err
+	}
+	for _, category := range names {
+		if category == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Renames a category, along with the categories nested in it. Their tasks
+// and audit logs go with them.
+func (manager *TaskManager) RenameCategory(from, to string) error {
+	return manager.moveCategory(from, to, false)
+}
+
+// Moves the tasks and audit log of one category, and the categories nested
+// in it, into another existing category, then removes it.
+func (manager *TaskManager) MergeCategory(from, into string) error {
+	return manager.moveCategory(from, into, true)
+}
+
+// Moves a category out of the way, into ARCHIVE_CATEGORY, keeping its
+// tasks and audit log. Archiving a category with the same name as one
+// that's already archived merges the two.
+func (manager *TaskManager) ArchiveCategory(name string) error {
+	name, err := CleanCategory(name)
+	if err != nil {
+		return err
+	}
+	if archived(name) {
+		return errors.New(fmt.Sprintf("Category \"%s\" is already archived", name))
+	}
+	archive := path.Join(ARCHIVE_CATEGORY, name)
+	exists, err := manager.CategoryExists(archive)
+	if err != nil {
+		return err
+	}
+	return manager.moveCategory(name, archive, exists)
+}
+
+func (manager *TaskManager) moveCategory(from, to string, merge bool) error {
+	from, err := manager.existingCategory(from)
+	if err != nil {
+		return err
+	}
+	to, err = CleanCategory(to)
+	if err != nil {
+		return err
+	}
+	if to == "" || inCategory(to, from) {
+		return errors.New(fmt.Sprintf("Can't move \"%s\" to %s", from, categoryName(to)))
+	}
+	exists, err := manager.CategoryExists(to)
+	if err != nil {
+		return err
+	}
+	if exists && !merge {
+		return fmt.Errorf("%w: \"%s\"", ErrCategoryExists, to)
+	} else if !exists && merge {
+		return fmt.Errorf("%w: \"%s\"", ErrCategoryNotFound, to)
+	}
+
+	unlock, err := manager.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// Moving the tasks mustn't put two with the same body in one category
+	tasks, err := manager.store().ListTasks()
+	if err != nil && !IsCorrupt(err) {
+		return err
+	}
+	var tx Transaction
+	for _, task := range tasks {
+		if inCategory(task.Category(), from) {
+			category := movedCategory(task.Category(), from, to)
+			moved, _ := TaskChanges{Category: &category}.Apply(task)
+			tx.Delete = append(tx.Delete, task)
+			tx.Put = append(tx.Put, moved)
+		}
+	}
+	if err := manager.checkMoves(tx); err != nil {
+		return err
+	}
+	for _, parent := range parentCategories(to) {
+		if err := manager.store().CreateCategory(parent); err != nil {
+			return err
+		}
+	}
+	if err := manager.store().MoveCategory(from, to); err != nil {
+		return err
+	}
+	// The records that moved are indexed under their old category
+	return manager.dropSearchIndex()
+}
 
-			_, fileName := filepath.Split(path)
-			split := strings.Split(fileName, ".")
-			if len(split) < 2 || split[1] != "todo" {
-				return nil
+// Deletes a category, along with the categories nested in it and their
+// audit logs. Unless forced, a category that still has tasks is not
+// deleted.
+func (manager *TaskManager) DeleteCategory(name string, force bool) error {
+	name, err := manager.existingCategory(name)
+	if err != nil {
+		return err
+	}
+	unlock, err := manager.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !force {
+		tasks, err := manager.store().ListTasks()
+		if err != nil && !IsCorrupt(err) {
+			return err
+		}
+		for _, task := range tasks {
+			if inCategory(task.Category(), name) {
+				return fmt.Errorf("%w: \"%s\"", ErrCategoryNotEmpty, name)
 			}
-			fileName = split[0]
-			task.index = fileName
-			task.fullIndex = fileName
-			bytes, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
+		}
+	}
+	if err := manager.store().DeleteCategory(name); err != nil {
+		return err
+	}
+	return manager.dropSearchIndex()
+}
+
+// Cleans a category's name and makes sure it exists.
+func (manager *TaskManager) existingCategory(name string) (string, error) {
+	name, err := CleanCategory(name)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", errors.New("No category given")
+	}
+	exists, err := manager.CategoryExists(name)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("%w: \"%s\"", ErrCategoryNotFound, name)
+	}
+	return name, nil
+}
+
+// Determines if something in a category should be listed, given the
+// manager's category.
+func (manager *TaskManager) listed(category string) bool {
+	return inCategory(category, manager.Category) &&
+		(!archived(category) || archived(manager.Category))
+}
+
+// Lists the categories along with how many tasks are due in each, counting
+// the tasks of the categories nested in them. Archived categories are left
+// out unless the manager's category is archived.
+//
+// Corrupt tasks are not counted, see GetTasks for reporting them.
+func (manager *TaskManager) GetCategories() (Categories, error) {
+	names, err := manager.store().ListCategories()
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := manager.store().ListTasks()
+	if err != nil && !IsCorrupt(err) {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, task := range tasks {
+		if task.DueToday() && task.Category() != "" {
+			for _, category := range append(parentCategories(task.Category()), task.Category()) {
+				counts[category] += 1
 			}
-			err = json.Unmarshal(bytes, &task)
-			if err != nil {
-				return err
+		}
+	}
+	// Not every store keeps the categories a category is nested in
+	seen := make(map[string]bool)
+	var categories Categories
+	for _, name := range names {
+		for _, category := range append(parentCategories(name), name) {
+			if seen[category] || (archived(category) && !archived(manager.Category)) {
+				continue
 			}
-			task.index = fileName
-			task.fullIndex = fileName
-			tasks = append(tasks, task)
-			return nil
-		})
-	if err != nil {
-		panic(err)
+			seen[category] = true
+			categories = append(categories, Category{
+				Name:  category,
+				Tasks: counts[category],
+			})
+		}
 	}
-	return tasks
+	sort.Sort(categories)
+	return categories, nil
 }
 
-func (manager *TaskManager) GetTasks() Tasks {
-	tasks := manager.getTasksHelper()
-	categories := manager.GetCategories()
-	originalDirectory := manager.StorageDirectory
-	for _, category := range categories {
-		manager.StorageDirectory = path.Join(originalDirectory, category.Name)
-		categoryName := category.Name
-		newTasks := manager.getTasksHelper()
-		for i, _ := range newTasks {
-			newTasks[i].category = &categoryName
+// Lists the tasks, limited to the manager's category, and the categories
+// nested in it, if it has one.
+//
+// Tasks that can't be read are skipped. If there are any they are
+// reported with a CorruptTasksError, returned along with every task that
+// could be read.
+func (manager *TaskManager) GetTasks() (Tasks, error) {
+	allTasks, err := manager.store().ListTasks()
+	if err != nil && !IsCorrupt(err) {
+		return nil, err
+	}
+	var tasks Tasks
+	for _, task := range allTasks {
+		if manager.listed(task.Category()) {
+			task.clock = manager.clock()
+			tasks = append(tasks, task)
 		}
-		tasks = append(tasks, newTasks...)
 	}
-	manager.StorageDirectory = originalDirectory
 	tasks = tasks.Condense()
+	tasks.markBlocked(allTasks)
 	sort.Sort(tasks)
-	return tasks
+	return tasks, err
 }
 
 func (tasks *Tasks) RemoveFirst(toRemove Task) {
 	for i, task := range *tasks {
-		if task == toRemove {
+		if task.ID == toRemove.ID {
 			*tasks = append((*tasks)[:i], (*tasks)[i+1:]...)
 			return
 		}
@@ -293,92 +605,51 @@ func (tasks_ Tasks) FilterTasksDueBeforeToday() []Task {
 		}
 	}
 	sort.Sort(tasks)
+	// Everything here is due, so what matters most comes first
+	sort.Stable(tasksByPriority(tasks))
 	return tasks
 }
 
-func (manager *TaskManager) AuditLog(task Task, done_date time.Time, annotation string) {
-	createDir(manager.StorageDirectory)
-	auditLogPath := path.Join(manager.StorageDirectory, AUDIT_LOG)
-	var auditLogFile *os.File
-	if _, err := os.Stat(auditLogPath); os.IsNotExist(err) {
-		perms := os.O_APPEND | os.O_WRONLY | os.O_CREATE
-		auditLogFile, err = os.OpenFile(auditLogPath, perms, 0600)
-		if err != nil {
-			panic(err)
-		}
-		auditLogFile.WriteString("#" + AUDIT_FIELDS)
-	} else {
-		auditLogFile, err = os.OpenFile(auditLogPath, os.O_APPEND|os.O_WRONLY, 0600)
-		if err != nil {
-			panic(err)
-		}
+func (manager *TaskManager) AuditLog(task Task, done_date time.Time, annotation string) error {
+	unlock, err := manager.Lock()
+	if err != nil {
+		return err
 	}
+	defer unlock()
+	record := NewRecord(task, done_date, annotation)
+	if err := manager.store().AppendRecord(record); err != nil {
+		return err
+	}
+	return manager.recordsLogged(Records{record})
+}
 
-	defer auditLogFile.Close()
-
-	audit_log := csv.NewWriter(auditLogFile)
-
+// Creates the audit record for completing a task, without logging it.
+func NewRecord(task Task, done_date time.Time, annotation string) Record {
 	var record Record
 	record.BodyContent = task.BodyContent
 	record.DueDate = task.DueDate
 	record.Repeat = task.Repeat
 	record.OverdueDays = task.OverdueDays
+	record.Category = task.Category()
 	record.DateCompleted = done_date
 	record.Annotation = annotation
-
-	if err := audit_log.Write(record.Marshal()); err != nil {
-		panic(err)
-	}
-	audit_log.Flush()
+	record.Tags = task.Tags
+	return record
 }
 
-func (manager *TaskManager) AuditRecords() Records {
-	createDir(manager.StorageDirectory)
-	categories := manager.GetCategories()
+func (manager *TaskManager) AuditRecords() (Records, error) {
+	allRecords, err := manager.store().ListRecords()
+	if err != nil {
+		return nil, err
+	}
 	var records Records
-
-	// Append nil category to get the root audit log
-	for _, category := range append(categories, Category{}) {
-		auditLogPath := path.Join(manager.StorageDirectory, category.Name, AUDIT_LOG)
-		if _, err := os.Stat(auditLogPath); os.IsNotExist(err) {
-			continue
-		}
-
-		auditLogFile, err := os.OpenFile(auditLogPath, os.O_RDONLY, 0600)
-		if err != nil {
-			panic(err)
-		}
-		defer auditLogFile.Close()
-
-		audit_log := csv.NewReader(auditLogFile)
-		audit_log.FieldsPerRecord = -1
-		audit_log.Comment = '#'
-
-		readRecords, err := audit_log.ReadAll()
-		if err != nil {
-			panic(err)
-		}
-		for _, readRecord := range readRecords {
-			record := Unmarshal(readRecord)
-			record.Category = category.Name
+	for _, record := range allRecords {
+		if manager.listed(record.Category) {
 			records = append(records, record)
 		}
 	}
 
 	sort.Sort(records)
 
-	return records
-}
-
-// Creates a directory if it does not exist
-func createDir(directoryPath string) {
-	if _, err := os.Stat(directoryPath); os.IsNotExist(err) {
-		if err = os.Mkdir(directoryPath, 0700); err != nil {
-			panic(err)
-		}
-	} else if err != nil {
-		msg := fmt.Sprintf("Could not read task storage: %v", err)
-		LogError(msg)
-		panic(msg)
-	}
+	return records, nil
 }
@@ -0,0 +1,84 @@
+package todo
+
+import (
+	"errors"
+	"testing"
+)
+
+// Every task stored, by body with its category.
+func storedBodies(t *testing.T, taskManager *TaskManager) []string {
+	tasks, err := taskManager.store().ListTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return taskBodies(tasks)
+}
+
+func TestMoveTasks(t *testing.T) {
+	taskManager, _ := testManagers()
+	bob := createTestTask(t, taskManager, "call bob")
+	report := createTestTask(t, taskManager, "write report")
+	createTestTask(t, taskManager, "buy milk")
+	tasks, err := taskManager.GetTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	indices := []string{bob.GetFullIndex(), report.GetFullIndex()}
+	if _, err := taskManager.MoveTasks(tasks, indices, "work"); err == nil {
+		t.Error("moving to a category that doesn't exist should fail")
+	}
+	if err := taskManager.CreateCategory("work"); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := taskManager.MoveTasks(tasks, indices, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 2 || moved[0].ID != bob.ID {
+		t.Errorf("moved %v, want the same tasks", moved)
+	}
+	want := []string{":buy milk", "work:call bob", "work:write report"}
+	if got := storedBodies(t, taskManager); !equalStrings(got, want) {
+		t.Errorf("stored %v, want %v", got, want)
+	}
+
+	// Nothing moves if one of them would end up next to the same task
+	createTestTask(t, taskManager, "call bob")
+	tasks, err = taskManager.GetTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indicesLeft []string
+	for _, task := range tasks {
+		if task.Category() == "" {
+			indicesLeft = append(indicesLeft, task.GetFullIndex())
+		}
+	}
+	if _, err := taskManager.MoveTasks(tasks, indicesLeft, "work"); !errors.Is(err, ErrTaskExists) {
+		t.Errorf("moving another \"call bob\" into work: got %v, want %v", err, ErrTaskExists)
+	}
+	want = []string{":buy milk", ":call bob", "work:call bob", "work:write report"}
+	if got := storedBodies(t, taskManager); !equalStrings(got, want) {
+		t.Errorf("after failing to move, stored %v, want %v", got, want)
+	}
+
+	// Back out of any category
+	if _, err := taskManager.MoveTasks(tasks, []string{findIndex(t, tasks, "write report")}, ""); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{":buy milk", ":call bob", ":write report", "work:call bob"}
+	if got := storedBodies(t, taskManager); !equalStrings(got, want) {
+		t.Errorf("after moving back, stored %v, want %v", got, want)
+	}
+}
+
+// The index of the task with the body.
+func findIndex(t *testing.T, tasks Tasks, body string) string {
+	for _, task := range tasks {
+		if task.BodyContent == body {
+			return task.GetFullIndex()
+		}
+	}
+	t.Fatalf("no task %q", body)
+	return ""
+}
@@ -0,0 +1,195 @@
+package todo
+
+import (
+	"sort"
+	"sync"
+)
+
+// A Store that only lives in memory. Useful for embedding and for tests
+// that should not touch the disk.
+type MemoryStore struct {
+	// Held by Lock, separately from mutex which guards single operations.
+	lock       sync.Mutex
+	mutex      sync.Mutex
+	tasks      map[string]Task
+	categories map[string]bool
+	records    Records
+	meta       map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tasks:      make(map[string]Task),
+		categories: make(map[string]bool),
+		meta:       make(map[string][]byte),
+	}
+}
+
+// Copies a task so the caller can't alias the stored category or
+// reminders.
+func copyTask(task Task) Task {
+	if task.category != nil {
+		category := *task.category
+		task.category = &category
+	}
+	task.Reminders = append([]Reminder(nil), task.Reminders...)
+	task.Tags = append([]string(nil), task.Tags...)
+	task.Checklist = append([]ChecklistItem(nil), task.Checklist...)
+	task.BlockedBy = append([]string(nil), task.BlockedBy...)
+	task.setIndex()
+	return task
+}
+
+func (store *MemoryStore) ListTasks() (Tasks, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	tasks := make(Tasks, 0, len(store.tasks))
+	for _, task := range store.tasks {
+		tasks = append(tasks, copyTask(task))
+	}
+	return tasks, nil
+}
+
+func (store *MemoryStore) GetTask(id string) (*Task, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	task, exists := store.tasks[id]
+	if !exists {
+		return nil, nil
+	}
+	task = copyTask(task)
+	return &task, nil
+}
+
+func (store *MemoryStore) PutTask(task Task) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if task.Category() != "" {
+		store.categories[task.Category()] = true
+	}
+	store.tasks[task.ID] = copyTask(task)
+	return nil
+}
+
+func (store *MemoryStore) DeleteTask(task Task) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.tasks, task.ID)
+	return nil
+}
+
+func (store *MemoryStore) ListCategories() ([]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var categories []string
+	for category := range store.categories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
+
+func (store *MemoryStore) CreateCategory(name string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.categories[name] = true
+	return nil
+}
+
+func (store *MemoryStore) MoveCategory(from, to string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for id, task := range store.tasks {
+		if inCategory(task.Category(), from) {
+			category := movedCategory(task.Category(), from, to)
+			task.category = &category
+			store.tasks[id] = task
+		}
+	}
+	for i, record := range store.records {
+		if inCategory(record.Category, from) {
+			store.records[i].Category = movedCategory(record.Category, from, to)
+		}
+	}
+	var moved []string
+	for category := range store.categories {
+		if inCategory(category, from) {
+			delete(store.categories, category)
+			moved = append(moved, movedCategory(category, from, to))
+		}
+	}
+	for _, category := range moved {
+		store.categories[category] = true
+	}
+	return nil
+}
+
+func (store *MemoryStore) DeleteCategory(name string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for id, task := range store.tasks {
+		if inCategory(task.Category(), name) {
+			delete(store.tasks, id)
+		}
+	}
+	var records Records
+	for _, record := range store.records {
+		if !inCategory(record.Category, name) {
+			records = append(records, record)
+		}
+	}
+	store.records = records
+	for category := range store.categories {
+		if inCategory(category, name) {
+			delete(store.categories, category)
+		}
+	}
+	return nil
+}
+
+func (store *MemoryStore) AppendRecord(record Record) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if record.Category != "" {
+		store.categories[record.Category] = true
+	}
+	store.records = append(store.records, record)
+	return nil
+}
+
+func (store *MemoryStore) Lock() (func(), error) {
+	store.lock.Lock()
+	return store.lock.Unlock, nil
+}
+
+func (store *MemoryStore) ReadMeta(key string) ([]byte, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	data, exists := store.meta[key]
+	if !exists {
+		return nil, nil
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (store *MemoryStore) WriteMeta(key string, data []byte) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.meta[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (store *MemoryStore) AppendMeta(key string, data []byte) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if len(store.meta[key]) != 0 {
+		store.meta[key] = append(store.meta[key], data...)
+	}
+	return nil
+}
+
+func (store *MemoryStore) ListRecords() (Records, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return append(Records(nil), store.records...), nil
+}
@@ -0,0 +1,107 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// How important a task is, A being the most important. The zero value is
+// no priority, which comes after all the others.
+type Priority int
+
+const (
+	PRIORITY_NONE Priority = iota
+	PRIORITY_A
+	PRIORITY_B
+	PRIORITY_C
+	PRIORITY_D
+)
+
+const PRIORITY_LETTERS = "ABCD"
+
+// Parses a priority from A to D, or 1 to 4. "" and "0" are no priority.
+func ParsePriority(text string) (Priority, error) {
+	text = strings.ToUpper(strings.TrimSpace(text))
+	if text == "" || text == "0" {
+		return PRIORITY_NONE, nil
+	}
+	if len(text) == 1 {
+		if i := strings.Index(PRIORITY_LETTERS, text); i >= 0 {
+			return Priority(i + 1), nil
+		}
+		if text[0] >= '1' && int(text[0]-'0') <= len(PRIORITY_LETTERS) {
+			return Priority(text[0] - '0'), nil
+		}
+	}
+	return PRIORITY_NONE, errors.New(fmt.Sprintf("Bad priority \"%s\", need A to D or 1 to 4", text))
+}
+
+func (priority Priority) String() string {
+	if priority == PRIORITY_NONE {
+		return ""
+	}
+	return PRIORITY_LETTERS[priority-1 : priority]
+}
+
+// Determines if the priority is more important than the other.
+func (priority Priority) Above(other Priority) bool {
+	return priority.rank() < other.rank()
+}
+
+// Determines if the priority is at least as important as the minimum. Every
+// priority is, if there's no minimum.
+func (priority Priority) AtLeast(minimum Priority) bool {
+	return minimum == PRIORITY_NONE || !minimum.Above(priority)
+}
+
+// Ranks no priority after the others
+func (priority Priority) rank() int {
+	if priority == PRIORITY_NONE {
+		return len(PRIORITY_LETTERS) + 1
+	}
+	return int(priority)
+}
+
+func (priority Priority) MarshalText() ([]byte, error) {
+	return []byte(priority.String()), nil
+}
+
+func (priority *Priority) UnmarshalText(text []byte) error {
+	parsed, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*priority = parsed
+	return nil
+}
+
+// The tasks at least as important as the minimum.
+func (tasks_ Tasks) FilterTasksByPriority(minimum Priority) Tasks {
+	tasks := make(Tasks, 0)
+	for _, task := range tasks_ {
+		if task.Priority.AtLeast(minimum) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// Sorts by category then priority, leaving tasks otherwise in the order
+// they were in when sorted stably.
+type tasksByPriority Tasks
+
+func (tasks tasksByPriority) Len() int {
+	return len(tasks)
+}
+
+func (tasks tasksByPriority) Less(i, j int) bool {
+	if comparison := compareCategories(tasks[i], tasks[j]); comparison != 0 {
+		return comparison < 0
+	}
+	return tasks[i].Priority.Above(tasks[j].Priority)
+}
+
+func (tasks tasksByPriority) Swap(i, j int) {
+	tasks[i], tasks[j] = tasks[j], tasks[i]
+}
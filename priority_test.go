@@ -0,0 +1,88 @@
+package todo
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParsePriority(t *testing.T) {
+	tests := []struct {
+		text string
+		want Priority
+	}{
+		{"", PRIORITY_NONE},
+		{"0", PRIORITY_NONE},
+		{"A", PRIORITY_A},
+		{"b", PRIORITY_B},
+		{"3", PRIORITY_C},
+		{" D ", PRIORITY_D},
+	}
+	for _, test := range tests {
+		if got, err := ParsePriority(test.text); err != nil || got != test.want {
+			t.Errorf("ParsePriority(%q) = %v, %v, want %v", test.text, got, err, test.want)
+		}
+	}
+	for _, text := range []string{"E", "5", "AB", "high"} {
+		if got, err := ParsePriority(text); err == nil {
+			t.Errorf("ParsePriority(%q) = %v, want an error", text, got)
+		}
+	}
+}
+
+func TestPriorityOrdering(t *testing.T) {
+	task := func(body string, priority Priority, days int, hour int) Task {
+		task := testTask(t, body, "")
+		task.setDueDate(testDay(2026, 10, 18+days, hour, 0))
+		task.Priority = priority
+		return task
+	}
+	tasks := Tasks{
+		task("later, A", PRIORITY_A, 1, 0),
+		task("none", PRIORITY_NONE, 0, 0),
+		task("C at 9", PRIORITY_C, 0, 9),
+		task("A", PRIORITY_A, 0, 12),
+		task("C at 8", PRIORITY_C, 0, 8),
+	}
+	sort.Sort(tasks)
+	var got []string
+	for _, task := range tasks {
+		got = append(got, task.BodyContent)
+	}
+	// The day comes first, then the priority, then the time of day
+	if want := []string{"A", "C at 8", "C at 9", "none", "later, A"}; !equalStrings(got, want) {
+		t.Errorf("sorted %v, want %v", got, want)
+	}
+
+	got = nil
+	for _, task := range tasks.FilterTasksByPriority(PRIORITY_C) {
+		got = append(got, task.BodyContent)
+	}
+	if want := []string{"A", "C at 8", "C at 9", "later, A"}; !equalStrings(got, want) {
+		t.Errorf("at least C %v, want %v", got, want)
+	}
+	if got := tasks.FilterTasksByPriority(PRIORITY_NONE); len(got) != len(tasks) {
+		t.Errorf("with no minimum kept %d of %d tasks", len(got), len(tasks))
+	}
+}
+
+// Priorities are stored as their letter.
+func TestPriorityJSON(t *testing.T) {
+	task := testTask(t, "write report", "")
+	task.Priority = PRIORITY_B
+	data, err := json.Marshal(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Priority":"B"`) {
+		t.Errorf("wrote %s, want the priority as B", data)
+	}
+	var read Task
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	if read.Priority != PRIORITY_B {
+		t.Errorf("read back priority %v, want B", read.Priority)
+	}
+}
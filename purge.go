@@ -0,0 +1,217 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// What happens to a task left overdue.
+type PurgeAction string
+
+const (
+	// Leave it be
+	PURGE_NEVER PurgeAction = "never"
+	// Move it into ".archive", keeping its category under it
+	PURGE_ARCHIVE PurgeAction = "archive"
+	// Remove it, logging it in the audit log as dropped
+	PURGE_DROP PurgeAction = "drop"
+	// Remove it without a trace. Repeating tasks move on to their next
+	// occurrence instead.
+	PURGE_DELETE PurgeAction = "delete"
+)
+
+const DEFAULT_PURGE_DAYS = 3
+const DEFAULT_PURGE_REASON = "overdue"
+
+func (action *PurgeAction) UnmarshalText(text []byte) error {
+	switch PurgeAction(text) {
+	case PURGE_NEVER, PURGE_ARCHIVE, PURGE_DROP, PURGE_DELETE:
+		*action = PurgeAction(text)
+		return nil
+	}
+	return errors.New(fmt.Sprintf("Bad purge action \"%s\", need one of never, archive, drop or delete",
+		text))
+}
+
+// How a category's overdue tasks are purged.
+type PurgePolicy struct {
+	Action PurgeAction
+	// How many days overdue a task can be before it's purged,
+	// DEFAULT_PURGE_DAYS if not given.
+	Days *int `json:",omitempty"`
+	// Logged with dropped tasks, DEFAULT_PURGE_REASON if not given.
+	Reason string `json:",omitempty"`
+}
+
+// Dropping tasks after DEFAULT_PURGE_DAYS, so nothing is lost without a
+// record of it.
+var DEFAULT_PURGE_POLICY = PurgePolicy{Action: PURGE_DROP}
+
+func (policy PurgePolicy) days() int {
+	if policy.Days == nil {
+		return DEFAULT_PURGE_DAYS
+	}
+	return *policy.Days
+}
+
+func (policy PurgePolicy) reason() string {
+	if policy.Reason == "" {
+		return DEFAULT_PURGE_REASON
+	}
+	return policy.Reason
+}
+
+func (policy *PurgePolicy) UnmarshalJSON(data []byte) error {
+	type plainPolicy PurgePolicy
+	if err := json.Unmarshal(data, (*plainPolicy)(policy)); err != nil {
+		return err
+	}
+	if policy.Action == "" {
+		return errors.New("Purge policy needs an Action")
+	}
+	if policy.Days != nil && *policy.Days < 0 {
+		return errors.New("Purge policy Days can't be negative")
+	}
+	return nil
+}
+
+// Purge policies by category. A category's policy also covers the
+// categories nested in it, unless they have their own. "" covers every
+// category without one, otherwise it's DEFAULT_PURGE_POLICY.
+type PurgePolicies map[string]PurgePolicy
+
+// The policy for a category's tasks.
+func (policies PurgePolicies) For(category string) PurgePolicy {
+	categories := append([]string{""}, parentCategories(category)...)
+	if category != "" {
+		categories = append(categories, category)
+	}
+	for i := len(categories) - 1; i >= 0; i-- {
+		if policy, exists := policies[categories[i]]; exists {
+			return policy
+		}
+	}
+	return DEFAULT_PURGE_POLICY
+}
+
+// An overdue task, and what its policy does with it.
+type Purge struct {
+	Task        Task
+	Policy      PurgePolicy
+	OverdueDays int
+}
+
+func (purge Purge) String() string {
+	body := strings.TrimSuffix(purge.Task.BodyContent, "\n")
+	overdue := fmt.Sprintf("%d days overdue", purge.OverdueDays)
+	switch purge.Policy.Action {
+	case PURGE_ARCHIVE:
+		return fmt.Sprintf("Archive \"%s\" to %s, %s", body,
+			categoryName(archiveCategory(purge.Task.Category())), overdue)
+	case PURGE_DROP:
+		return fmt.Sprintf("Drop \"%s\" as %s, %s", body, purge.Policy.reason(), overdue)
+	case PURGE_DELETE:
+		if purge.Task.Repeat != nil {
+			return fmt.Sprintf("Skip \"%s\" to its next occurrence, %s", body, overdue)
+		}
+		return fmt.Sprintf("Delete \"%s\", %s", body, overdue)
+	}
+	return fmt.Sprintf("Keep \"%s\", %s", body, overdue)
+}
+
+// Where archiving a task in a category moves it to.
+func archiveCategory(category string) string {
+	return path.Join(ARCHIVE_CATEGORY, category)
+}
+
+// Works out what the policies would purge from the tasks, without purging
+// anything.
+func (cmdManager *CommandManager) PlanPurge(tasks Tasks, policies PurgePolicies) []Purge {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	var purges []Purge
+	for _, task := range tasks {
+		policy := policies.For(task.Category())
+		if policy.Action == PURGE_NEVER ||
+			policy.Action == PURGE_ARCHIVE && archived(task.Category()) {
+			continue
+		}
+		finalDueDate := task.DueDate.AddDate(0, 0, task.OverdueDays)
+		overdue_days := daysBetween(finalDueDate, cmdManager.now())
+		if overdue_days > policy.days() {
+			purges = append(purges, Purge{task, policy, overdue_days})
+		}
+	}
+	return purges
+}
+
+// Purges the tasks, as planned by PlanPurge.
+func (cmdManager *CommandManager) Purge(taskManager *TaskManager, purges []Purge) error {
+	cmdManager.mutex.Lock()
+	defer cmdManager.mutex.Unlock()
+	for _, purge := range purges {
+		var err error
+		task := purge.Task
+		switch purge.Policy.Action {
+		case PURGE_ARCHIVE:
+			err = cmdManager.archiveTask(taskManager, task)
+		case PURGE_DROP:
+			err = cmdManager.dropTask(taskManager, task, purge.Policy.reason())
+		case PURGE_DELETE:
+			err = cmdManager.deleteTask(taskManager, task)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cmdManager *CommandManager) archiveTask(taskManager *TaskManager, task Task) error {
+	category := archiveCategory(task.Category())
+	if err := taskManager.CreateCategory(category); err != nil {
+		return err
+	}
+	moved, _ := TaskChanges{Category: &category}.Apply(task)
+	tx := Transaction{Delete: Tasks{task}, Put: Tasks{moved}}
+	cmdManager.tasks = nil
+	return cmdManager.commitUnchanged(taskManager, task, tx)
+}
+
+// Removes a task without logging it. Like dropTask, a repeating task moves
+// on to its next occurrence from today instead.
+func (cmdManager *CommandManager) deleteTask(taskManager *TaskManager, task Task) error {
+	tx := Transaction{Delete: Tasks{task}}
+	if task.Repeat != nil {
+		next, err := task.upcomingOccurrence(cmdManager.now())
+		if err != nil {
+			return err
+		}
+		tx = taskManager.ReplaceTask(task, &next)
+		cmdManager.tasks = nil
+		return cmdManager.commitUnchanged(taskManager, task, tx)
+	}
+	cmdManager.tasks = nil
+	return cmdManager.commitDone(taskManager, task, tx)
+}
+
+// Removes a task, logging it as dropped. A repeating task moves on to its
+// next occurrence from today, so it's only dropped the once.
+func (cmdManager *CommandManager) dropTask(taskManager *TaskManager, task Task, reason string) error {
+	tx := Transaction{Delete: Tasks{task}}
+	if task.Repeat != nil {
+		next, err := task.upcomingOccurrence(cmdManager.now())
+		if err != nil {
+			return err
+		}
+		tx = taskManager.ReplaceTask(task, &next)
+	}
+	record := NewRecord(task, cmdManager.now(), reason)
+	record.Dropped = true
+	tx.Records = append(tx.Records, record)
+	cmdManager.tasks = nil
+	return cmdManager.commitDone(taskManager, task, tx)
+}
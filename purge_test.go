@@ -0,0 +1,138 @@
+package todo
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+func TestPurgePoliciesFor(t *testing.T) {
+	week := 7
+	policies := PurgePolicies{
+		"work":        {Action: PURGE_ARCHIVE},
+		"home":        {Action: PURGE_DELETE, Days: &week},
+		"home/garden": {Action: PURGE_NEVER},
+	}
+	tests := []struct {
+		category string
+		want     PurgeAction
+	}{
+		{"", PURGE_DROP},
+		{"work", PURGE_ARCHIVE},
+		{"work/clientA", PURGE_ARCHIVE},
+		{"home/garden/pond", PURGE_NEVER},
+		{"homework", PURGE_DROP},
+	}
+	for _, test := range tests {
+		if got := policies.For(test.category); got.Action != test.want {
+			t.Errorf("For(%q) = %v, want %v", test.category, got.Action, test.want)
+		}
+	}
+	policies[""] = PurgePolicy{Action: PURGE_NEVER}
+	if got := policies.For("homework"); got.Action != PURGE_NEVER {
+		t.Errorf("with a policy for \"\", For(\"homework\") = %v, want %v", got.Action, PURGE_NEVER)
+	}
+}
+
+func TestPurgePolicyJSON(t *testing.T) {
+	var policies PurgePolicies
+	data := `{"": {"Action": "delete", "Days": 7}, "home": {"Action": "drop", "Reason": "ran out of time"}}`
+	if err := json.Unmarshal([]byte(data), &policies); err != nil {
+		t.Fatal(err)
+	}
+	if policy := policies[""]; policy.Action != PURGE_DELETE || policy.days() != 7 {
+		t.Errorf("read %+v, want delete after 7 days", policy)
+	}
+	if policy := policies["home"]; policy.days() != DEFAULT_PURGE_DAYS || policy.reason() != "ran out of time" {
+		t.Errorf("read %+v, want the default days and the reason", policy)
+	}
+	for _, data := range []string{
+		`{"": {"Days": 7}}`,
+		`{"": {"Action": "shred"}}`,
+		`{"": {"Action": "drop", "Days": -1}}`,
+	} {
+		if err := json.Unmarshal([]byte(data), &policies); err == nil {
+			t.Errorf("reading %s should fail", data)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	taskManager, _ := testManagers()
+	for _, category := range []string{"work", "home/garden"} {
+		if err := taskManager.CreateCategory(category); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Tasks ten days overdue
+	create := func(category, body string, repeat *Recurrence) {
+		_, cmdManager := testManagers()
+		cmdManager.DueDate = testClock.Now().AddDate(0, 0, -10)
+		cmdManager.Repeat = repeat
+		if _, err := cmdManager.CreateTask(inTestCategory(taskManager, category), body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create("", "buy milk", nil)
+	create("work", "write report", nil)
+	create("home", "fix sink", nil)
+	create("home", "water plants", &Recurrence{Frequency: WEEKLY})
+	create("home/garden", "mow lawn", nil)
+
+	fortnight := 14
+	policies := PurgePolicies{
+		"work":        {Action: PURGE_ARCHIVE},
+		"home":        {Action: PURGE_DELETE},
+		"home/garden": {Action: PURGE_NEVER},
+		"":            {Action: PURGE_DROP, Reason: "forgot"},
+	}
+	_, cmdManager := testManagers()
+	tasks, err := taskManager.GetTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Not overdue for long enough
+	if purges := cmdManager.PlanPurge(tasks, PurgePolicies{"": {Action: PURGE_DROP, Days: &fortnight}}); len(purges) != 0 {
+		t.Errorf("planned %v for tasks that aren't overdue enough", purges)
+	}
+	purges := cmdManager.PlanPurge(tasks, policies)
+	var planned []string
+	for _, purge := range purges {
+		planned = append(planned, purge.String())
+	}
+	sort.Strings(planned)
+	want := []string{
+		`Archive "write report" to ".archive/work", 10 days overdue`,
+		`Delete "fix sink", 10 days overdue`,
+		`Drop "buy milk" as forgot, 10 days overdue`,
+		`Skip "water plants" to its next occurrence, 10 days overdue`,
+	}
+	if !equalStrings(planned, want) {
+		t.Errorf("planned %v, want %v", planned, want)
+	}
+
+	if err := cmdManager.Purge(taskManager, purges); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{".archive/work:write report", "home/garden:mow lawn", "home:water plants"}
+	if got := storedBodies(t, taskManager); !equalStrings(got, want) {
+		t.Errorf("after purging, stored %v, want %v", got, want)
+	}
+	tasks, err = inTestCategory(taskManager, "home").GetTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range tasks {
+		if task.BodyContent == "water plants" && task.DueDate.Before(startOfDay(testClock.Now())) {
+			t.Errorf("water plants still due %v", task.DueDate)
+		}
+	}
+	records, err := taskManager.AuditRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].BodyContent != "buy milk" || !records[0].Dropped ||
+		records[0].Annotation != "forgot" {
+		t.Errorf("audit log %v, want buy milk dropped", records)
+	}
+}
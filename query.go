@@ -0,0 +1,581 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Fields a query can ask about.
+const (
+	QUERY_BODY       = "body"
+	QUERY_CATEGORY   = "category"
+	QUERY_TAG        = "tag"
+	QUERY_DUE        = "due"
+	QUERY_OVERDUE    = "overdue"
+	QUERY_REPEAT     = "repeat"
+	QUERY_PRIORITY   = "priority"
+	QUERY_COMPLETED  = "completed"
+	QUERY_ANNOTATION = "annotation"
+	QUERY_BLOCKED    = "blocked"
+)
+
+// Other names fields go by, e.g. the CLI calls annotations notes.
+var queryAliases = map[string]string{
+	"notes": QUERY_ANNOTATION,
+	"done":  QUERY_COMPLETED,
+}
+
+// Longest first, so "<=" isn't read as "<"
+var queryOperators = []string{"!=", "<=", ">=", ":", "=", "<", ">"}
+
+var queryYear = regexp.MustCompile(`^\d{4}$`)
+var queryMonth = regexp.MustCompile(`^(\d{4})[-/](\d{1,2})$`)
+
+// A filter over tasks and audit records, e.g. overdue category:work
+// repeat:weekly, or completed:march not notes="" for March's audit
+// records with notes.
+//
+// A query is made of terms, which all have to hold unless separated by
+// "or". "not" or "-" in front of a term turns it around, and parentheses
+// group terms. A term is a field, an operator and a value:
+//
+//   - body, annotation (or notes): ":" contains, "=" is, "!=" isn't
+//   - category: ":" is or is nested in, "=" is, "!=" isn't
+//   - tag: ":" or "=" has, "!=" doesn't have
+//   - due, completed (or done): a day ParseDate reads, a month such as
+//     "march", "march 2026" or "2026-03", or a year, compared with ":",
+//     "=", "!=", "<", "<=", ">" and ">="
+//   - overdue: a number of days, compared the same way
+//   - priority: A to D, where more important is greater, e.g. "priority>=B"
+//   - repeat: "daily", "weekly", "monthly" or "yearly", or any repeat
+//     ParseRecurrence reads
+//
+// "overdue", "repeat" and "blocked" on their own are tasks that are
+// overdue, that repeat, and that are waiting on another task. Any other
+// word on its own is looked for in the body. Values with spaces can be
+// quoted, e.g. body:"buy milk". Tasks haven't been completed and don't
+// have annotations, so terms about those never hold for tasks.
+type Query struct {
+	Text string
+	root queryNode
+}
+
+// What a query is asked about, either a task or a record.
+type queryItem struct {
+	body       string
+	category   string
+	tags       []string
+	due        time.Time
+	overdue    int
+	repeat     *Recurrence
+	priority   Priority
+	completed  *time.Time
+	annotation string
+	blocked    bool
+}
+
+type queryNode interface {
+	match(item queryItem) bool
+}
+
+type queryAnd []queryNode
+type queryOr []queryNode
+type queryNot struct{ node queryNode }
+type queryTerm func(item queryItem) bool
+
+func (and queryAnd) match(item queryItem) bool {
+	for _, node := range and {
+		if !node.match(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (or queryOr) match(item queryItem) bool {
+	for _, node := range or {
+		if node.match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+func (not queryNot) match(item queryItem) bool {
+	return !not.node.match(item)
+}
+
+func (term queryTerm) match(item queryItem) bool {
+	return term(item)
+}
+
+// Parses a query, reading dates in it relative to now.
+func ParseQuery(text string, now time.Time) (*Query, error) {
+	tokens, err := queryTokens(text)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad query \"%s\": %v", text, err))
+	}
+	parser := queryParser{tokens: tokens, now: now}
+	root, err := parser.or()
+	if err == nil && parser.i < len(tokens) {
+		err = errors.New(fmt.Sprintf("unexpected \"%s\"", tokens[parser.i]))
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad query \"%s\": %v", text, err))
+	}
+	return &Query{Text: text, root: root}, nil
+}
+
+func (query *Query) MatchTask(task Task) bool {
+	due := task.DueAt()
+	overdue := daysBetween(due, task.now())
+	if overdue < 0 {
+		overdue = 0
+	}
+	return query.root.match(queryItem{
+		body:     task.BodyContent,
+		category: task.Category(),
+		tags:     task.Tags,
+		due:      due,
+		overdue:  overdue,
+		repeat:   task.Repeat,
+		priority: task.Priority,
+		blocked:  task.blocked,
+	})
+}
+
+func (query *Query) MatchRecord(record Record) bool {
+	due := record.DueDate.AddDate(0, 0, record.OverdueDays)
+	overdue := daysBetween(due, record.DateCompleted)
+	if overdue < 0 {
+		overdue = 0
+	}
+	completed := record.DateCompleted
+	return query.root.match(queryItem{
+		body:       record.BodyContent,
+		category:   record.Category,
+		tags:       record.Tags,
+		due:        due,
+		overdue:    overdue,
+		repeat:     record.Repeat,
+		completed:  &completed,
+		annotation: record.Annotation,
+	})
+}
+
+// The tasks the query matches. A nil query matches everything.
+func (tasks_ Tasks) FilterTasksByQuery(query *Query) Tasks {
+	if query == nil {
+		return tasks_
+	}
+	tasks := make(Tasks, 0)
+	for _, task := range tasks_ {
+		if query.MatchTask(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// The records the query matches. A nil query matches everything.
+func (records_ Records) FilterRecordsByQuery(query *Query) Records {
+	if query == nil {
+		return records_
+	}
+	var records Records
+	for _, record := range records_ {
+		if query.MatchRecord(record) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Splits a query into words and parentheses. Quotes keep spaces and
+// parentheses in a word, and are removed.
+func queryTokens(text string) ([]string, error) {
+	var tokens []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, c := range text {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case c == '(' || c == ')' || c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				tokens = append(tokens, word.String())
+				word.Reset()
+				inWord = false
+			}
+			if c == '(' || c == ')' {
+				tokens = append(tokens, string(c))
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unclosed quote")
+	}
+	if inWord {
+		tokens = append(tokens, word.String())
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []string
+	i      int
+	now    time.Time
+}
+
+func (parser *queryParser) peek() string {
+	if parser.i < len(parser.tokens) {
+		return parser.tokens[parser.i]
+	}
+	return ""
+}
+
+func (parser *queryParser) or() (queryNode, error) {
+	var or queryOr
+	for {
+		node, err := parser.and()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, node)
+		if !strings.EqualFold(parser.peek(), "or") {
+			break
+		}
+		parser.i++
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (parser *queryParser) and() (queryNode, error) {
+	var and queryAnd
+	for parser.i < len(parser.tokens) {
+		next := parser.peek()
+		if next == ")" || strings.EqualFold(next, "or") {
+			break
+		}
+		if strings.EqualFold(next, "and") {
+			parser.i++
+			continue
+		}
+		node, err := parser.not()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, node)
+	}
+	if len(and) == 0 {
+		if parser.i < len(parser.tokens) {
+			return nil, errors.New(fmt.Sprintf("nothing before \"%s\"", parser.peek()))
+		}
+		return nil, errors.New("nothing to look for")
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (parser *queryParser) not() (queryNode, error) {
+	token := parser.peek()
+	switch {
+	case strings.EqualFold(token, "not"):
+		parser.i++
+		node, err := parser.not()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{node}, nil
+	case len(token) > 1 && strings.HasPrefix(token, "-"):
+		// e.g. -tag:waiting
+		parser.tokens[parser.i] = token[1:]
+		node, err := parser.not()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{node}, nil
+	case token == "(":
+		parser.i++
+		node, err := parser.or()
+		if err != nil {
+			return nil, err
+		}
+		if parser.peek() != ")" {
+			return nil, errors.New("unclosed parenthesis")
+		}
+		parser.i++
+		return node, nil
+	}
+	parser.i++
+	return parser.term(token)
+}
+
+// Parses a term such as "category:work", or a word on its own.
+func (parser *queryParser) term(token string) (queryNode, error) {
+	letters := len(token) - len(strings.TrimLeftFunc(token, unicode.IsLetter))
+	field, rest := strings.ToLower(token[:letters]), token[letters:]
+	operator := ""
+	for _, op := range queryOperators {
+		if strings.HasPrefix(rest, op) {
+			operator = op
+			break
+		}
+	}
+	if field == "" || operator == "" {
+		return parser.word(token)
+	}
+	if alias, exists := queryAliases[field]; exists {
+		field = alias
+	}
+	if !isQueryField(field) {
+		return nil, errors.New(fmt.Sprintf("no such field \"%s\"", field))
+	}
+	value := rest[len(operator):]
+	switch field {
+	case QUERY_BODY:
+		return stringTerm(operator, value, func(item queryItem) string { return item.body })
+	case QUERY_ANNOTATION:
+		return stringTerm(operator, value, func(item queryItem) string { return item.annotation })
+	case QUERY_CATEGORY:
+		return categoryTerm(operator, value)
+	case QUERY_TAG:
+		return tagTerm(operator, value)
+	case QUERY_DUE:
+		return parser.dateTerm(operator, value, func(item queryItem) *time.Time { return &item.due })
+	case QUERY_COMPLETED:
+		return parser.dateTerm(operator, value, func(item queryItem) *time.Time { return item.completed })
+	case QUERY_OVERDUE:
+		return overdueTerm(operator, value)
+	case QUERY_PRIORITY:
+		return priorityTerm(operator, value)
+	case QUERY_REPEAT:
+		return repeatTerm(operator, value)
+	}
+	return nil, errors.New(fmt.Sprintf("no such field \"%s\"", field))
+}
+
+func isQueryField(field string) bool {
+	switch field {
+	case QUERY_BODY, QUERY_CATEGORY, QUERY_TAG, QUERY_DUE, QUERY_OVERDUE,
+		QUERY_REPEAT, QUERY_PRIORITY, QUERY_COMPLETED, QUERY_ANNOTATION:
+		return true
+	}
+	return false
+}
+
+// A word without a field
+func (parser *queryParser) word(word string) (queryNode, error) {
+	switch strings.ToLower(word) {
+	case QUERY_OVERDUE:
+		return queryTerm(func(item queryItem) bool { return item.overdue > 0 }), nil
+	case QUERY_REPEAT:
+		return queryTerm(func(item queryItem) bool { return item.repeat != nil }), nil
+	case QUERY_BLOCKED:
+		return queryTerm(func(item queryItem) bool { return item.blocked }), nil
+	}
+	return stringTerm(":", word, func(item queryItem) string { return item.body })
+}
+
+func badOperator(operator, field string) error {
+	return errors.New(fmt.Sprintf("can't use \"%s\" with %s", operator, field))
+}
+
+func stringTerm(operator, value string, field func(queryItem) string) (queryNode, error) {
+	lower := strings.ToLower(value)
+	switch operator {
+	case ":":
+		return queryTerm(func(item queryItem) bool {
+			return strings.Contains(strings.ToLower(field(item)), lower)
+		}), nil
+	case "=":
+		return queryTerm(func(item queryItem) bool {
+			return strings.EqualFold(strings.TrimSpace(field(item)), value)
+		}), nil
+	case "!=":
+		return queryTerm(func(item queryItem) bool {
+			return !strings.EqualFold(strings.TrimSpace(field(item)), value)
+		}), nil
+	}
+	return nil, badOperator(operator, "text")
+}
+
+func categoryTerm(operator, value string) (queryNode, error) {
+	category, err := CleanCategory(value)
+	if err != nil {
+		return nil, err
+	}
+	switch operator {
+	case ":":
+		return queryTerm(func(item queryItem) bool {
+			return category == "" && item.category == "" ||
+				category != "" && inCategory(item.category, category)
+		}), nil
+	case "=":
+		return queryTerm(func(item queryItem) bool { return item.category == category }), nil
+	case "!=":
+		return queryTerm(func(item queryItem) bool { return item.category != category }), nil
+	}
+	return nil, badOperator(operator, QUERY_CATEGORY)
+}
+
+func tagTerm(operator, value string) (queryNode, error) {
+	tag, err := CleanTag(value)
+	if err != nil {
+		return nil, err
+	}
+	switch operator {
+	case ":", "=":
+		return queryTerm(func(item queryItem) bool { return hasTag(item.tags, tag) }), nil
+	case "!=":
+		return queryTerm(func(item queryItem) bool { return !hasTag(item.tags, tag) }), nil
+	}
+	return nil, badOperator(operator, QUERY_TAG)
+}
+
+func (parser *queryParser) dateTerm(operator, value string,
+	field func(queryItem) *time.Time) (queryNode, error) {
+	start, end, err := parser.dateRange(value)
+	if err != nil {
+		return nil, err
+	}
+	return queryTerm(func(item queryItem) bool {
+		date := field(item)
+		if date == nil {
+			return false
+		}
+		switch operator {
+		case "<":
+			return date.Before(start)
+		case "<=":
+			return date.Before(end)
+		case ">":
+			return !date.Before(end)
+		case ">=":
+			return !date.Before(start)
+		case "!=":
+			return date.Before(start) || !date.Before(end)
+		}
+		return !date.Before(start) && date.Before(end)
+	}), nil
+}
+
+// The span of time a date in a query covers: a year, a month or a day.
+func (parser *queryParser) dateRange(value string) (start, end time.Time, err error) {
+	location := parser.now.Location()
+	if queryYear.MatchString(value) {
+		year, _ := strconv.Atoi(value)
+		start = time.Date(year, 1, 1, 0, 0, 0, 0, location)
+		return start, start.AddDate(1, 0, 0), nil
+	}
+	if match := queryMonth.FindStringSubmatch(value); match != nil {
+		year, _ := strconv.Atoi(match[1])
+		month, _ := strconv.Atoi(match[2])
+		if month < 1 || month > 12 {
+			return start, end, errors.New(fmt.Sprintf("no such month \"%s\"", value))
+		}
+		start = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, location)
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	// e.g. "march" or "march 2026", but not "march 5"
+	words := strings.Fields(strings.ToLower(value))
+	if len(words) == 1 || len(words) == 2 && queryYear.MatchString(words[1]) {
+		if month, isMonth := friendlyMonth(words[0]); isMonth {
+			year := parser.now.Year()
+			if len(words) == 2 {
+				year, _ = strconv.Atoi(words[1])
+			}
+			start = time.Date(year, month, 1, 0, 0, 0, 0, location)
+			return start, start.AddDate(0, 1, 0), nil
+		}
+	}
+	day, err := ParseDate(value, parser.now)
+	if err != nil {
+		return start, end, err
+	}
+	start = startOfDay(day)
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+func overdueTerm(operator, value string) (queryNode, error) {
+	days, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("overdue needs a number of days, not \"%s\"", value))
+	}
+	return queryTerm(func(item queryItem) bool {
+		return compareInts(operator, item.overdue, days)
+	}), nil
+}
+
+func compareInts(operator string, a, b int) bool {
+	switch operator {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "!=":
+		return a != b
+	}
+	return a == b
+}
+
+func priorityTerm(operator, value string) (queryNode, error) {
+	priority, err := ParsePriority(value)
+	if err != nil {
+		return nil, err
+	}
+	// Ranked so more important is greater, with no priority the least
+	return queryTerm(func(item queryItem) bool {
+		return compareInts(operator, -item.priority.rank(), -priority.rank())
+	}), nil
+}
+
+func repeatTerm(operator, value string) (queryNode, error) {
+	var matches func(repeat *Recurrence) bool
+	if frequency, isFrequency := map[string]Frequency{
+		"daily": DAILY, "weekly": WEEKLY, "monthly": MONTHLY, "yearly": YEARLY,
+	}[strings.ToLower(value)]; isFrequency {
+		matches = func(repeat *Recurrence) bool {
+			return repeat != nil && repeat.Frequency == frequency
+		}
+	} else {
+		rule, err := ParseRecurrence(value)
+		if err != nil {
+			return nil, err
+		}
+		matches = func(repeat *Recurrence) bool {
+			return repeat != nil && repeat.RRULE() == rule.RRULE()
+		}
+	}
+	switch operator {
+	case ":", "=":
+		return queryTerm(func(item queryItem) bool { return matches(item.repeat) }), nil
+	case "!=":
+		return queryTerm(func(item queryItem) bool { return !matches(item.repeat) }), nil
+	}
+	return nil, badOperator(operator, QUERY_REPEAT)
+}
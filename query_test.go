@@ -0,0 +1,124 @@
+package todo
+
+import (
+	"testing"
+	"time"
+)
+
+// Tasks to query, as of testClock.
+func queryTestTasks(t *testing.T) Tasks {
+	milk := testTask(t, "buy milk +shopping", "")
+	milk.Priority = PRIORITY_B
+
+	report := testTask(t, "write report", "work")
+	report.setDueDate(testDay(2026, 10, 15, 0, 0))
+	report.Priority = PRIORITY_A
+
+	gym := testTask(t, "go to the gym", "home/fitness")
+	gym.setDueDate(testDay(2026, 10, 20, 0, 0))
+	gym.Repeat = &Recurrence{Frequency: WEEKLY}
+
+	taxes := testTask(t, "file taxes", "")
+	taxes.setDueDate(testDay(2026, 11, 2, 0, 0))
+	taxes.blocked = true
+
+	tasks := Tasks{milk, report, gym, taxes}
+	for i := range tasks {
+		tasks[i].clock = testClock
+	}
+	return tasks
+}
+
+func TestQueryMatchTask(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"milk", []string{":buy milk +shopping"}},
+		{"body:REPORT", []string{"work:write report"}},
+		{"tag:shopping", []string{":buy milk +shopping"}},
+		{"-tag:shopping", []string{":file taxes", "home/fitness:go to the gym", "work:write report"}},
+		{"category:home", []string{"home/fitness:go to the gym"}},
+		{"category=home", nil},
+		{"category:", []string{":buy milk +shopping", ":file taxes"}},
+		{"overdue", []string{"work:write report"}},
+		{"overdue>=3", []string{"work:write report"}},
+		{"overdue>3", nil},
+		{"repeat", []string{"home/fitness:go to the gym"}},
+		{"repeat:weekly", []string{"home/fitness:go to the gym"}},
+		{"repeat!=daily", []string{":buy milk +shopping", ":file taxes",
+			"home/fitness:go to the gym", "work:write report"}},
+		{"priority>=B", []string{":buy milk +shopping", "work:write report"}},
+		{"priority=A", []string{"work:write report"}},
+		{"due:today", []string{":buy milk +shopping"}},
+		{"due<today", []string{"work:write report"}},
+		{"due>today", []string{":file taxes", "home/fitness:go to the gym"}},
+		{"due:october", []string{":buy milk +shopping", "home/fitness:go to the gym", "work:write report"}},
+		{"due:2026-11", []string{":file taxes"}},
+		{"blocked", []string{":file taxes"}},
+		{"milk or report", []string{":buy milk +shopping", "work:write report"}},
+		{"not (milk or report)", []string{":file taxes", "home/fitness:go to the gym"}},
+		{"category:work and priority=A", []string{"work:write report"}},
+		{`body:"the gym"`, []string{"home/fitness:go to the gym"}},
+		// Tasks are never completed
+		{"completed:today", nil},
+	}
+	tasks := queryTestTasks(t)
+	for _, test := range tests {
+		query, err := ParseQuery(test.query, testClock.Now())
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.query, err)
+			continue
+		}
+		if got := taskBodies(tasks.FilterTasksByQuery(query)); !equalStrings(got, test.want) {
+			t.Errorf("%q matched %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestQueryMatchRecord(t *testing.T) {
+	task := testTask(t, "buy milk", "")
+	record := NewRecord(task, time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), "two pints")
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"notes:pints", true},
+		{`notes=""`, false},
+		{"done:2026/10/19", true},
+		{"completed<2026/10/19", false},
+		{"completed>=october", true},
+		{"overdue=1", true},
+		{"milk and not notes:litre", true},
+	}
+	for _, test := range tests {
+		query, err := ParseQuery(test.query, testClock.Now())
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", test.query, err)
+			continue
+		}
+		if got := query.MatchRecord(record); got != test.want {
+			t.Errorf("%q matched the record: %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"(milk",
+		"milk)",
+		"or milk",
+		"size:big",
+		"priority<Z",
+		"body<milk",
+		"overdue>lots",
+		"due:someday",
+		"due:2026-13",
+		`body:"unclosed`,
+	} {
+		if _, err := ParseQuery(text, testClock.Now()); err == nil {
+			t.Errorf("ParseQuery(%q) should fail", text)
+		}
+	}
+}
@@ -0,0 +1,626 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency int
+
+const (
+	DAILY Frequency = iota + 1
+	WEEKLY
+	MONTHLY
+	YEARLY
+)
+
+var frequencyNames = map[Frequency]string{
+	DAILY:   "DAILY",
+	WEEKLY:  "WEEKLY",
+	MONTHLY: "MONTHLY",
+	YEARLY:  "YEARLY",
+}
+
+var frequencyUnits = map[Frequency]string{
+	DAILY:   "day",
+	WEEKLY:  "week",
+	MONTHLY: "month",
+	YEARLY:  "year",
+}
+
+// The two letter weekday names RRULEs use, indexed by time.Weekday.
+var rruleWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// What a repeating task's next occurrence is counted from.
+type RepeatAnchor string
+
+const (
+	// The day the task was due, so it keeps to a schedule however late
+	// it's done.
+	FROM_DUE_DATE RepeatAnchor = ""
+	// The day the task was completed, e.g. for chores that only need
+	// doing a while after they were last done.
+	FROM_COMPLETION RepeatAnchor = "completion"
+)
+
+// Parses "due" or "done" (or "completion").
+func ParseRepeatAnchor(text string) (RepeatAnchor, error) {
+	switch strings.ToLower(text) {
+	case "due":
+		return FROM_DUE_DATE, nil
+	case "done", "completion", "completed":
+		return FROM_COMPLETION, nil
+	default:
+		return FROM_DUE_DATE, errors.New(fmt.Sprintf("Bad repeat anchor \"%s\", need \"due\" or \"done\"", text))
+	}
+}
+
+func (anchor RepeatAnchor) String() string {
+	if anchor == FROM_COMPLETION {
+		return "done"
+	}
+	return "due"
+}
+
+// A weekday a task repeats on. N picks out one of them in the month, or
+// in the year for yearly rules without months, e.g. 1 is the first and -1
+// the last. 0 is every one of them.
+type RecurrenceDay struct {
+	Weekday time.Weekday
+	N       int
+}
+
+// When a task repeats, a subset of an RFC 5545 RRULE. Each occurrence is
+// counted from the one before it, see RepeatAnchor.
+type Recurrence struct {
+	Frequency Frequency
+	// Repeat every Interval days, weeks, etc. 0 is the same as 1.
+	Interval int
+	// Limits the months the task repeats in.
+	Months []time.Month
+	// Days of the month, negative ones counting back from the end of it.
+	MonthDays []int
+	Weekdays  []RecurrenceDay
+}
+
+// Parses a recurrence, which is one of
+//
+//   - an RRULE, e.g. "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH"
+//   - a number of days, e.g. "3", which is how repeats used to be written
+//   - a friendly description, e.g. "every 2 weeks on Tue,Thu", "monthly
+//     on the 15th", "last Friday of the month", "monthly on the 2nd to
+//     last day", "every weekday", "yearly"
+//     or, like repeats used to be written, "monday,friday"
+func ParseRecurrence(text string) (*Recurrence, error) {
+	text = strings.TrimSpace(text)
+	var rule *Recurrence
+	var err error
+	if days, numErr := strconv.Atoi(text); numErr == nil {
+		if days <= 0 {
+			return nil, errors.New("Repeat time must be a positive, non-zero number")
+		}
+		rule = &Recurrence{Frequency: DAILY, Interval: days}
+	} else if upper := strings.ToUpper(text); strings.HasPrefix(upper, "RRULE:") ||
+		strings.HasPrefix(upper, "FREQ=") {
+		rule, err = parseRRULE(strings.TrimPrefix(upper, "RRULE:"))
+	} else {
+		rule, err = parseFriendlyRecurrence(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rule.validate(); err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad repeat \"%s\": %v", text, err))
+	}
+	return rule, nil
+}
+
+func parseRRULE(text string) (*Recurrence, error) {
+	var rule Recurrence
+	for _, part := range strings.Split(strings.TrimSuffix(text, ";"), ";") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, errors.New(fmt.Sprintf("Bad RRULE part \"%s\"", part))
+		}
+		key, value := keyValue[0], keyValue[1]
+		var err error
+		switch key {
+		case "FREQ":
+			for frequency, name := range frequencyNames {
+				if name == value {
+					rule.Frequency = frequency
+				}
+			}
+			if rule.Frequency == 0 {
+				err = errors.New("unsupported frequency")
+			}
+		case "INTERVAL":
+			rule.Interval, err = strconv.Atoi(value)
+		case "BYMONTH":
+			for _, month := range strings.Split(value, ",") {
+				var number int
+				number, err = strconv.Atoi(month)
+				rule.Months = append(rule.Months, time.Month(number))
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				var number int
+				number, err = strconv.Atoi(day)
+				rule.MonthDays = append(rule.MonthDays, number)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				var recurrenceDay RecurrenceDay
+				recurrenceDay, err = parseRRULEDay(day)
+				rule.Weekdays = append(rule.Weekdays, recurrenceDay)
+			}
+		case "WKST":
+			// Weeks start on Monday, which is the default
+			if value != "MO" {
+				err = errors.New("only MO is supported")
+			}
+		default:
+			err = errors.New("not supported")
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Bad RRULE part \"%s\": %v", part, err))
+		}
+	}
+	return &rule, nil
+}
+
+// Parses a BYDAY weekday, e.g. "FR" or "-1FR".
+func parseRRULEDay(day string) (RecurrenceDay, error) {
+	if len(day) < 2 {
+		return RecurrenceDay{}, errors.New("bad weekday")
+	}
+	name := day[len(day)-2:]
+	for weekday, rruleName := range rruleWeekdays {
+		if rruleName != name {
+			continue
+		}
+		n := 0
+		if ordinal := day[:len(day)-2]; ordinal != "" {
+			var err error
+			if n, err = strconv.Atoi(ordinal); err != nil {
+				return RecurrenceDay{}, err
+			}
+		}
+		return RecurrenceDay{time.Weekday(weekday), n}, nil
+	}
+	return RecurrenceDay{}, errors.New(fmt.Sprintf("bad weekday \"%s\"", name))
+}
+
+var friendlyFrequencies = map[string]Frequency{
+	"day": DAILY, "days": DAILY, "daily": DAILY,
+	"week": WEEKLY, "weeks": WEEKLY, "weekly": WEEKLY,
+	"month": MONTHLY, "months": MONTHLY, "monthly": MONTHLY,
+	"year": YEARLY, "years": YEARLY, "yearly": YEARLY, "annually": YEARLY,
+}
+
+var friendlyOrdinals = map[string]int{
+	"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "last": -1,
+}
+
+// Words that only make the description read better.
+var friendlyFillers = map[string]bool{
+	"every": true, "each": true, "on": true, "the": true, "of": true,
+	"in": true, "and": true, "repeat": true,
+}
+
+func parseFriendlyRecurrence(text string) (*Recurrence, error) {
+	words := strings.Fields(strings.ToLower(strings.Replace(text, ",", " ", -1)))
+	var rule Recurrence
+	bad := func(format string, args ...interface{}) (*Recurrence, error) {
+		return nil, errors.New(fmt.Sprintf("Bad repeat \"%s\": ", text) +
+			fmt.Sprintf(format, args...))
+	}
+	setFrequency := func(frequency Frequency) bool {
+		if rule.Frequency != 0 && rule.Frequency != frequency {
+			return false
+		}
+		rule.Frequency = frequency
+		return true
+	}
+	// An ordinal waiting to see if it's followed by a weekday or is a day
+	// of the month, e.g. "last Friday" or "the last day".
+	ordinal := 0
+	// Whether the ordinal was e.g. "2nd to", so "last" counts it back
+	toLast := false
+	flushOrdinal := func() {
+		if ordinal != 0 {
+			rule.MonthDays = append(rule.MonthDays, ordinal)
+			ordinal = 0
+		}
+	}
+	for i, word := range words {
+		weekday, isWeekday := friendlyWeekday(word)
+		month, isMonth := friendlyMonth(word)
+		frequency, isFrequency := friendlyFrequencies[word]
+		n, isOrdinal := friendlyOrdinal(word)
+		number, numberErr := strconv.Atoi(word)
+		switch {
+		case ordinal > 0 && word == "to" && i+1 < len(words) && words[i+1] == "last":
+			// e.g. "the 2nd to last day"
+			ordinal = -ordinal
+			toLast = true
+		case toLast:
+			toLast = false
+		case isWeekday:
+			rule.Weekdays = append(rule.Weekdays, RecurrenceDay{weekday, ordinal})
+			ordinal = 0
+		case ordinal != 0 && (word == "day" || word == "days"):
+			flushOrdinal()
+		case isOrdinal:
+			flushOrdinal()
+			ordinal = n
+		case word == "weekday" || word == "weekdays":
+			for weekday := time.Monday; weekday <= time.Friday; weekday++ {
+				rule.Weekdays = append(rule.Weekdays, RecurrenceDay{weekday, 0})
+			}
+		case word == "weekend" || word == "weekends":
+			rule.Weekdays = append(rule.Weekdays,
+				RecurrenceDay{time.Saturday, 0}, RecurrenceDay{time.Sunday, 0})
+		case isMonth:
+			flushOrdinal()
+			rule.Months = append(rule.Months, month)
+		case isFrequency:
+			flushOrdinal()
+			if !setFrequency(frequency) {
+				return bad("\"%s\" doesn't go with %s", word,
+					strings.ToLower(frequencyNames[rule.Frequency]))
+			}
+		case numberErr == nil && i+1 < len(words) && rule.Interval == 0:
+			// e.g. "every 2 weeks"
+			rule.Interval = number
+		case word == "other":
+			rule.Interval = 2
+		case friendlyFillers[word]:
+			continue
+		default:
+			return bad("don't know \"%s\"", word)
+		}
+	}
+	flushOrdinal()
+
+	if rule.Frequency == 0 {
+		switch {
+		case len(rule.Months) != 0:
+			rule.Frequency = YEARLY
+		case len(rule.MonthDays) != 0:
+			rule.Frequency = MONTHLY
+		case len(rule.Weekdays) != 0:
+			rule.Frequency = WEEKLY
+			for _, weekday := range rule.Weekdays {
+				if weekday.N != 0 {
+					rule.Frequency = MONTHLY
+				}
+			}
+		default:
+			return bad("say how often, e.g. \"every 3 days\" or \"weekly\"")
+		}
+	}
+	return &rule, nil
+}
+
+func friendlyWeekday(word string) (time.Weekday, bool) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := strings.ToLower(weekday.String())
+		// e.g. "tue", "tues" or "tuesdays"
+		if word == name+"s" || len(word) >= 3 && strings.HasPrefix(name, word) {
+			return weekday, true
+		}
+	}
+	return 0, false
+}
+
+func friendlyMonth(word string) (time.Month, bool) {
+	for month := time.January; month <= time.December; month++ {
+		name := strings.ToLower(month.String())
+		if len(word) >= 3 && strings.HasPrefix(name, word) {
+			return month, true
+		}
+	}
+	return 0, false
+}
+
+// Parses "second", "2nd", "last" and the like.
+func friendlyOrdinal(word string) (int, bool) {
+	if n, exists := friendlyOrdinals[word]; exists {
+		return n, true
+	}
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		if strings.HasSuffix(word, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(word, suffix))
+			return n, err == nil && n > 0
+		}
+	}
+	return 0, false
+}
+
+func (rule Recurrence) validate() error {
+	if _, exists := frequencyNames[rule.Frequency]; !exists {
+		return errors.New("no frequency")
+	}
+	if rule.Interval < 0 {
+		return errors.New("the interval must be positive")
+	}
+	for _, month := range rule.Months {
+		if month < time.January || month > time.December {
+			return errors.New(fmt.Sprintf("bad month %d", month))
+		}
+	}
+	for _, day := range rule.MonthDays {
+		if day == 0 || day < -31 || day > 31 {
+			return errors.New(fmt.Sprintf("bad day of the month %d", day))
+		}
+	}
+	if len(rule.MonthDays) != 0 && (rule.Frequency == DAILY || rule.Frequency == WEEKLY) {
+		return errors.New("days of the month need a monthly or yearly repeat")
+	}
+	for _, weekday := range rule.Weekdays {
+		if weekday.N != 0 && rule.Frequency != MONTHLY && rule.Frequency != YEARLY {
+			return errors.New("the first, last, etc. weekday needs a monthly or yearly repeat")
+		}
+		if weekday.N < -53 || weekday.N > 53 {
+			return errors.New(fmt.Sprintf("bad weekday number %d", weekday.N))
+		}
+	}
+	return nil
+}
+
+func (rule Recurrence) interval() int {
+	if rule.Interval < 1 {
+		return 1
+	}
+	return rule.Interval
+}
+
+// Gets the first day after the given one the task repeats on, keeping the
+// time of day.
+func (rule Recurrence) Next(after time.Time) (time.Time, error) {
+	// Long enough for a yearly repeat on the 29th of February
+	limit := 366 * 8 * rule.interval()
+	for i := 1; i <= limit; i++ {
+		day := after.AddDate(0, 0, i)
+		if rule.matches(day, after) {
+			return day, nil
+		}
+	}
+	return after, errors.New(fmt.Sprintf("\"%s\" never repeats", rule))
+}
+
+// Determines if the task repeats on a day, counting from start.
+func (rule Recurrence) matches(day, start time.Time) bool {
+	var periods int
+	switch rule.Frequency {
+	case DAILY:
+		periods = daysBetween(start, day)
+	case WEEKLY:
+		periods = daysBetween(weekStart(start), weekStart(day)) / 7
+	case MONTHLY:
+		periods = (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+	case YEARLY:
+		periods = day.Year() - start.Year()
+	}
+	if periods%rule.interval() != 0 {
+		return false
+	}
+
+	if len(rule.Months) != 0 {
+		if !containsMonth(rule.Months, day.Month()) {
+			return false
+		}
+	} else if rule.Frequency == YEARLY && day.Month() != start.Month() &&
+		(len(rule.MonthDays) == 0 && len(rule.Weekdays) == 0) {
+		return false
+	}
+	if len(rule.MonthDays) != 0 && !rule.onMonthDay(day) {
+		return false
+	}
+	if len(rule.Weekdays) != 0 && !rule.onWeekday(day) {
+		return false
+	}
+	if len(rule.MonthDays) == 0 && len(rule.Weekdays) == 0 {
+		switch rule.Frequency {
+		case WEEKLY:
+			return day.Weekday() == start.Weekday()
+		case MONTHLY, YEARLY:
+			return day.Day() == start.Day()
+		}
+	}
+	return true
+}
+
+func (rule Recurrence) onMonthDay(day time.Time) bool {
+	length := daysInMonth(day)
+	for _, monthDay := range rule.MonthDays {
+		if monthDay == day.Day() || length+monthDay+1 == day.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule Recurrence) onWeekday(day time.Time) bool {
+	for _, weekday := range rule.Weekdays {
+		if weekday.Weekday != day.Weekday() {
+			continue
+		}
+		if weekday.N == 0 {
+			return true
+		}
+		// Which of this weekday it is, from the start and from the end
+		var first, last int
+		if rule.Frequency == YEARLY && len(rule.Months) == 0 {
+			daysInYear := time.Date(day.Year(), 12, 31, 0, 0, 0, 0, time.UTC).YearDay()
+			first = (day.YearDay()-1)/7 + 1
+			last = -((daysInYear-day.YearDay())/7 + 1)
+		} else {
+			first = (day.Day()-1)/7 + 1
+			last = -((daysInMonth(day)-day.Day())/7 + 1)
+		}
+		if weekday.N == first || weekday.N == last {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+	for _, m := range months {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func daysInMonth(day time.Time) int {
+	return time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// Counts calendar days, ignoring the time of day and daylight saving.
+func daysBetween(a, b time.Time) int {
+	aDate := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	bDate := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(bDate.Sub(aDate).Hours() / 24)
+}
+
+// The Monday of the week a day is in.
+func weekStart(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// Writes the recurrence as an RRULE, without the "RRULE:" prefix.
+func (rule Recurrence) RRULE() string {
+	parts := []string{"FREQ=" + frequencyNames[rule.Frequency]}
+	if rule.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.Interval))
+	}
+	if len(rule.Months) != 0 {
+		months := make([]string, len(rule.Months))
+		for i, month := range rule.Months {
+			months[i] = strconv.Itoa(int(month))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(rule.MonthDays) != 0 {
+		days := make([]string, len(rule.MonthDays))
+		for i, day := range rule.MonthDays {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(rule.Weekdays) != 0 {
+		days := make([]string, len(rule.Weekdays))
+		for i, day := range rule.Weekdays {
+			days[i] = rruleWeekdays[day.Weekday]
+			if day.N != 0 {
+				days[i] = strconv.Itoa(day.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Describes the recurrence in the friendly syntax ParseRecurrence reads.
+func (rule Recurrence) String() string {
+	unit := frequencyUnits[rule.Frequency]
+	description := "every " + unit
+	if rule.interval() > 1 {
+		description = fmt.Sprintf("every %d %ss", rule.interval(), unit)
+	}
+	if rule.isWeekdays() && rule.interval() == 1 &&
+		(rule.Frequency == DAILY || rule.Frequency == WEEKLY) {
+		return "every weekday"
+	}
+	if len(rule.Months) != 0 {
+		months := make([]string, len(rule.Months))
+		for i, month := range rule.Months {
+			months[i] = month.String()[:3]
+		}
+		description += " in " + strings.Join(months, ",")
+	}
+	var on []string
+	for _, day := range rule.MonthDays {
+		if day == -1 {
+			on = append(on, "the last day")
+		} else {
+			on = append(on, "the "+ordinalName(day))
+		}
+	}
+	var weekdays []string
+	for _, day := range rule.Weekdays {
+		name := day.Weekday.String()[:3]
+		if day.N != 0 {
+			on = append(on, "the "+ordinalName(day.N)+" "+name)
+		} else {
+			weekdays = append(weekdays, name)
+		}
+	}
+	if len(weekdays) != 0 {
+		on = append(on, strings.Join(weekdays, ","))
+	}
+	if len(on) != 0 {
+		description += " on " + strings.Join(on, " and ")
+	}
+	return description
+}
+
+// Determines if the recurrence is on every weekday, Monday to Friday.
+func (rule Recurrence) isWeekdays() bool {
+	if len(rule.Weekdays) != 5 || len(rule.Months) != 0 || len(rule.MonthDays) != 0 {
+		return false
+	}
+	for _, day := range rule.Weekdays {
+		if day.N != 0 || day.Weekday == time.Saturday || day.Weekday == time.Sunday {
+			return false
+		}
+	}
+	return true
+}
+
+func ordinalName(n int) string {
+	if n == -1 {
+		return "last"
+	} else if n < 0 {
+		return ordinalName(-n) + " to last"
+	}
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// Recurrences are written in the task JSON as their RRULE. Repeats used to
+// be written as a number of days or a list of weekdays, which still read.
+func (rule Recurrence) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rule.RRULE())
+}
+
+func (rule *Recurrence) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	parsed, err := ParseRecurrence(text)
+	if err != nil {
+		return err
+	}
+	*rule = *parsed
+	return nil
+}
@@ -0,0 +1,191 @@
+package todo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecurrenceStringRoundTrip(t *testing.T) {
+	rules := []Recurrence{
+		{Frequency: DAILY},
+		{Frequency: DAILY, Interval: 3},
+		{Frequency: WEEKLY, Interval: 2, Weekdays: []RecurrenceDay{{time.Tuesday, 0}, {time.Thursday, 0}}},
+		{Frequency: MONTHLY, MonthDays: []int{15}},
+		{Frequency: MONTHLY, MonthDays: []int{-1}},
+		{Frequency: MONTHLY, MonthDays: []int{-2}},
+		{Frequency: MONTHLY, MonthDays: []int{1, -3}},
+		{Frequency: MONTHLY, Weekdays: []RecurrenceDay{{time.Friday, -1}}},
+		{Frequency: MONTHLY, Weekdays: []RecurrenceDay{{time.Friday, -2}}},
+		{Frequency: MONTHLY, Weekdays: []RecurrenceDay{{time.Monday, 2}}},
+		{Frequency: YEARLY, Months: []time.Month{time.March}, MonthDays: []int{-2}},
+	}
+	for _, rule := range rules {
+		text := rule.String()
+		parsed, err := ParseRecurrence(text)
+		if err != nil {
+			t.Errorf("%s: %v", text, err)
+			continue
+		}
+		if !reflect.DeepEqual(*parsed, rule) {
+			t.Errorf("%s: read back as %#v, want %#v", text, *parsed, rule)
+		}
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	weekdays := []RecurrenceDay{{time.Monday, 0}, {time.Tuesday, 0}, {time.Wednesday, 0},
+		{time.Thursday, 0}, {time.Friday, 0}}
+	tests := []struct {
+		text string
+		want Recurrence
+	}{
+		{"3", Recurrence{Frequency: DAILY, Interval: 3}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH",
+			Recurrence{Frequency: WEEKLY, Interval: 2, Weekdays: []RecurrenceDay{{time.Tuesday, 0}, {time.Thursday, 0}}}},
+		{"RRULE:FREQ=MONTHLY;BYDAY=-1FR", Recurrence{Frequency: MONTHLY, Weekdays: []RecurrenceDay{{time.Friday, -1}}}},
+		{"every 2 weeks on Tue,Thu",
+			Recurrence{Frequency: WEEKLY, Interval: 2, Weekdays: []RecurrenceDay{{time.Tuesday, 0}, {time.Thursday, 0}}}},
+		{"monthly on the 15th", Recurrence{Frequency: MONTHLY, MonthDays: []int{15}}},
+		{"last Friday of the month", Recurrence{Frequency: MONTHLY, Weekdays: []RecurrenceDay{{time.Friday, -1}}}},
+		{"monthly on the last day", Recurrence{Frequency: MONTHLY, MonthDays: []int{-1}}},
+		{"monthly on the 2nd to last day", Recurrence{Frequency: MONTHLY, MonthDays: []int{-2}}},
+		{"the 2nd to last Fri", Recurrence{Frequency: MONTHLY, Weekdays: []RecurrenceDay{{time.Friday, -2}}}},
+		{"every weekday", Recurrence{Frequency: WEEKLY, Weekdays: weekdays}},
+		{"every other day", Recurrence{Frequency: DAILY, Interval: 2}},
+		{"yearly", Recurrence{Frequency: YEARLY}},
+		{"every march on the 1st", Recurrence{Frequency: YEARLY, Months: []time.Month{time.March}, MonthDays: []int{1}}},
+		{"monday,friday", Recurrence{Frequency: WEEKLY, Weekdays: []RecurrenceDay{{time.Monday, 0}, {time.Friday, 0}}}},
+	}
+	for _, test := range tests {
+		got, err := ParseRecurrence(test.text)
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q): %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("ParseRecurrence(%q) = %#v, want %#v", test.text, *got, test.want)
+		}
+	}
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"0",
+		"-1",
+		"sometimes",
+		"every blue moon",
+		"weekly on the 15th",
+		"daily on the last Friday",
+		"FREQ=DAILY;BYMONTHDAY=5",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+	} {
+		if got, err := ParseRecurrence(text); err == nil {
+			t.Errorf("ParseRecurrence(%q) = %v, want an error", text, got)
+		}
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	// A Sunday morning
+	sunday := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule  string
+		after time.Time
+		want  time.Time
+	}{
+		{"every 3 days", sunday, time.Date(2026, 10, 21, 9, 0, 0, 0, time.UTC)},
+		{"weekly", sunday, time.Date(2026, 10, 25, 9, 0, 0, 0, time.UTC)},
+		// Every other week counts from the week it starts in
+		{"every 2 weeks on Tue,Thu", sunday, time.Date(2026, 10, 27, 9, 0, 0, 0, time.UTC)},
+		{"every weekday", sunday, time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"monthly on the 15th", sunday, time.Date(2026, 11, 15, 9, 0, 0, 0, time.UTC)},
+		{"monthly on the last day", sunday, time.Date(2026, 10, 31, 9, 0, 0, 0, time.UTC)},
+		{"monthly on the 2nd to last day", sunday, time.Date(2026, 10, 30, 9, 0, 0, 0, time.UTC)},
+		{"last Friday of the month", sunday, time.Date(2026, 10, 30, 9, 0, 0, 0, time.UTC)},
+		{"the 2nd to last Friday", sunday, time.Date(2026, 10, 23, 9, 0, 0, 0, time.UTC)},
+		{"the 2nd Monday", sunday, time.Date(2026, 11, 9, 9, 0, 0, 0, time.UTC)},
+		// Months without a 31st are skipped
+		{"monthly on the 31st", time.Date(2026, 10, 31, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{"yearly", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+			time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"every march on the 2nd to last day", sunday, time.Date(2027, 3, 30, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		rule, err := ParseRecurrence(test.rule)
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q): %v", test.rule, err)
+			continue
+		}
+		got, err := rule.Next(test.after)
+		if err != nil {
+			t.Errorf("%q.Next(%v): %v", test.rule, test.after, err)
+		} else if !got.Equal(test.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", test.rule, test.after, got, test.want)
+		}
+	}
+}
+
+func TestRecurrenceRRULE(t *testing.T) {
+	for _, text := range []string{
+		"FREQ=DAILY",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH",
+		"FREQ=MONTHLY;BYMONTHDAY=1,-2",
+		"FREQ=MONTHLY;BYDAY=-2FR",
+		"FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=-1",
+	} {
+		rule, err := ParseRecurrence(text)
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q): %v", text, err)
+		} else if rule.RRULE() != text {
+			t.Errorf("ParseRecurrence(%q).RRULE() = %q", text, rule.RRULE())
+		}
+	}
+}
+
+func TestParseRepeatAnchor(t *testing.T) {
+	for text, want := range map[string]RepeatAnchor{
+		"due":  FROM_DUE_DATE,
+		"Done": FROM_COMPLETION,
+		// As it's stored
+		"completion": FROM_COMPLETION,
+	} {
+		if got, err := ParseRepeatAnchor(text); err != nil || got != want {
+			t.Errorf("ParseRepeatAnchor(%q) = %q, %v, want %q", text, got, err, want)
+		}
+	}
+	if _, err := ParseRepeatAnchor("whenever"); err == nil {
+		t.Error("ParseRepeatAnchor(\"whenever\") should fail")
+	}
+}
+
+func TestNextDueDate(t *testing.T) {
+	weekly := &Recurrence{Frequency: DAILY, Interval: 7}
+	due := time.Date(2026, 10, 10, 0, 0, 0, 0, time.UTC)
+	dueAt := time.Date(2026, 10, 10, 9, 30, 0, 0, time.UTC)
+	// Done late, in the evening
+	done := time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		from       RepeatAnchor
+		due        time.Time
+		hasDueTime bool
+		want       time.Time
+	}{
+		{FROM_DUE_DATE, due, false, time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{FROM_COMPLETION, due, false, time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{FROM_DUE_DATE, dueAt, true, time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)},
+		// Keeps to the time of day it's due at
+		{FROM_COMPLETION, dueAt, true, time.Date(2026, 10, 25, 9, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		task := Task{DueDate: test.due, HasDueTime: test.hasDueTime, Repeat: weekly, RepeatFrom: test.from}
+		got, err := task.NextDueDate(done)
+		if err != nil {
+			t.Errorf("from %s at %v: %v", test.from, test.due, err)
+		} else if !is_same_day(got, test.want) || test.hasDueTime && !got.Equal(test.want) {
+			t.Errorf("from %s at %v: next due %v, want %v", test.from, test.due, got, test.want)
+		}
+	}
+}
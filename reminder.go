@@ -0,0 +1,163 @@
+package todo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The store meta key fired reminders are kept under.
+const FIRED_REMINDERS = "fired_reminders"
+
+// How long before a task is due to be reminded of it.
+type Reminder time.Duration
+
+// Parses a reminder such as "15m", "2h", "1d" or "1w2d", days and weeks
+// being 24 hours and 7 days.
+func ParseReminder(text string) (Reminder, error) {
+	bad := errors.New(fmt.Sprintf("Bad reminder \"%s\", need e.g. \"15m\", \"2h\" or \"1d\"", text))
+	var total time.Duration
+	rest := strings.ToLower(strings.TrimSpace(text))
+	if rest == "" {
+		return 0, bad
+	}
+	for rest != "" {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(rest) {
+			return 0, bad
+		}
+		count, _ := strconv.Atoi(rest[:i])
+		var unit time.Duration
+		switch rest[i] {
+		case 'w':
+			unit = 7 * DAY_HOURS
+		case 'd':
+			unit = DAY_HOURS
+		case 'h':
+			unit = time.Hour
+		case 'm':
+			unit = time.Minute
+		default:
+			return 0, bad
+		}
+		total += time.Duration(count) * unit
+		rest = rest[i+1:]
+	}
+	return Reminder(total), nil
+}
+
+// Writes the reminder the way ParseReminder reads it, e.g. "1d2h".
+func (reminder Reminder) String() string {
+	left := time.Duration(reminder)
+	if left == 0 {
+		return "0m"
+	}
+	var text string
+	for _, unit := range []struct {
+		suffix   string
+		duration time.Duration
+	}{{"d", DAY_HOURS}, {"h", time.Hour}, {"m", time.Minute}} {
+		if count := left / unit.duration; count != 0 {
+			text += strconv.Itoa(int(count)) + unit.suffix
+			left -= count * unit.duration
+		}
+	}
+	return text
+}
+
+func (reminder Reminder) MarshalText() ([]byte, error) {
+	return []byte(reminder.String()), nil
+}
+
+func (reminder *Reminder) UnmarshalText(text []byte) error {
+	parsed, err := ParseReminder(string(text))
+	if err != nil {
+		return err
+	}
+	*reminder = parsed
+	return nil
+}
+
+// A reminder that came due.
+type FiredReminder struct {
+	Task     Task
+	Reminder Reminder
+	// When the reminder was due to fire.
+	At time.Time
+}
+
+func (fired FiredReminder) String() string {
+	return fmt.Sprintf("%s is due %s", strings.TrimSuffix(fired.Task.BodyContent, "\n"),
+		fired.Task.DueAt().Format("Monday 2006/01/02 15:04"))
+}
+
+// Identifies a reminder for one occurrence of a task, so a repeating task
+// is reminded of again each time it comes around.
+func (fired FiredReminder) key() string {
+	return fmt.Sprintf("%s/%s/%s", fired.Task.ID,
+		fired.Task.DueAt().UTC().Format(time.RFC3339), fired.Reminder)
+}
+
+// Finds the reminders that have come due and haven't fired yet, oldest
+// first, and records them as fired in the store so they only fire once.
+func (manager *TaskManager) FireReminders() ([]FiredReminder, error) {
+	unlock, err := manager.Lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	tasks, err := manager.GetTasks()
+	if err != nil && !IsCorrupt(err) {
+		return nil, err
+	}
+	data, err := manager.store().ReadMeta(FIRED_REMINDERS)
+	if err != nil {
+		return nil, err
+	}
+	alreadyFired := make(map[string]time.Time)
+	if data != nil {
+		if err := json.Unmarshal(data, &alreadyFired); err != nil {
+			LogError("Forgetting unreadable fired reminders: " + err.Error())
+			alreadyFired = make(map[string]time.Time)
+		}
+	}
+
+	now := manager.clock().Now()
+	// Only keeps reminders that could still come up, so this doesn't grow
+	// forever.
+	stillFired := make(map[string]time.Time)
+	var fired []FiredReminder
+	for _, task := range tasks {
+		for _, reminder := range task.Reminders {
+			due := FiredReminder{task, reminder,
+				task.DueAt().Add(-time.Duration(reminder))}
+			if due.At.After(now) {
+				continue
+			}
+			if firedAt, exists := alreadyFired[due.key()]; exists {
+				stillFired[due.key()] = firedAt
+				continue
+			}
+			stillFired[due.key()] = now
+			fired = append(fired, due)
+		}
+	}
+	data, err = json.Marshal(stillFired)
+	if err != nil {
+		return nil, err
+	}
+	if err := manager.store().WriteMeta(FIRED_REMINDERS, data); err != nil {
+		return nil, err
+	}
+	sort.Slice(fired, func(i, j int) bool {
+		return fired[i].At.Before(fired[j].At)
+	})
+	return fired, nil
+}
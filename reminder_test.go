@@ -0,0 +1,76 @@
+package todo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReminder(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+		// As String writes it
+		written string
+	}{
+		{"15m", 15 * time.Minute, "15m"},
+		{"2h", 2 * time.Hour, "2h"},
+		{"1D", 24 * time.Hour, "1d"},
+		{"1w2d", 9 * 24 * time.Hour, "9d"},
+		{"90m", 90 * time.Minute, "1h30m"},
+	}
+	for _, test := range tests {
+		got, err := ParseReminder(test.text)
+		if err != nil {
+			t.Errorf("ParseReminder(%q): %v", test.text, err)
+			continue
+		}
+		if time.Duration(got) != test.want || got.String() != test.written {
+			t.Errorf("ParseReminder(%q) = %v written %q, want %v written %q",
+				test.text, time.Duration(got), got, test.want, test.written)
+		}
+	}
+	for _, text := range []string{"", "15", "m", "2x", "1h30"} {
+		if _, err := ParseReminder(text); err == nil {
+			t.Errorf("ParseReminder(%q) should fail", text)
+		}
+	}
+}
+
+func TestFireReminders(t *testing.T) {
+	taskManager, cmdManager := testManagers()
+	cmdManager.DueDate = time.Date(2026, 10, 18, 20, 0, 0, 0, time.UTC)
+	cmdManager.HasDueTime = true
+	for _, reminder := range []string{"12h", "1h"} {
+		if err := cmdManager.AddReminder(reminder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cmdManager.CreateTask(taskManager, "call mum"); err != nil {
+		t.Fatal(err)
+	}
+
+	fire := func(now time.Time) []string {
+		t.Helper()
+		taskManager := &TaskManager{Store: taskManager.Store, Clock: FixedClock{Time: now}}
+		fired, err := taskManager.FireReminders()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reminders []string
+		for _, reminder := range fired {
+			reminders = append(reminders, reminder.Reminder.String())
+		}
+		return reminders
+	}
+	// At 15:04 only the reminder at 8:00 has come due
+	if got, want := fire(testClock.Now()), []string{"12h"}; !equalStrings(got, want) {
+		t.Errorf("fired %v, want %v", got, want)
+	}
+	// Each only fires once
+	if got := fire(testClock.Now()); len(got) != 0 {
+		t.Errorf("fired %v again", got)
+	}
+	if got, want := fire(time.Date(2026, 10, 18, 19, 30, 0, 0, time.UTC)), []string{"1h"}; !equalStrings(got, want) {
+		t.Errorf("at 19:30 fired %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,382 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The store meta key the search index is kept under.
+const SEARCH_INDEX = "search_index"
+
+// How many audit records a search shows at most.
+const SEARCH_RECORD_LIMIT = 50
+
+// The audit log, ready to search without reading and parsing every audit
+// log. It's built the first time it's needed and kept up to date as
+// records are logged, see TaskManager.Commit.
+//
+// It's stored as a line of JSON per record, so records that were just
+// logged are appended to it rather than the whole index being rewritten.
+type searchIndex struct {
+	Records []indexedRecord
+	// Every word in the records, lower case, and which records have it
+	Words map[string][]int
+}
+
+type indexedRecord struct {
+	Category string
+	// As Record.Marshal writes them
+	Fields []string
+	// Every word in the record, lower case
+	Words []string
+}
+
+func indexRecord(record Record) indexedRecord {
+	return indexedRecord{record.Category, record.Marshal(),
+		uniqueWords(record.BodyContent, record.Annotation, strings.Join(record.Tags, " "))}
+}
+
+func (indexed indexedRecord) record() (Record, error) {
+	record, err := Unmarshal(indexed.Fields)
+	record.Category = indexed.Category
+	return record, err
+}
+
+func (index *searchIndex) add(indexed indexedRecord) {
+	position := len(index.Records)
+	index.Records = append(index.Records, indexed)
+	for _, word := range indexed.Words {
+		index.Words[word] = append(index.Words[word], position)
+	}
+}
+
+// Reads the index from its lines.
+func parseSearchIndex(data []byte) (*searchIndex, error) {
+	index := &searchIndex{Words: make(map[string][]int)}
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		var indexed indexedRecord
+		if err := json.Unmarshal(line, &indexed); err != nil {
+			return nil, err
+		}
+		if len(indexed.Fields) == 0 {
+			return nil, errors.New("Indexed record has no fields")
+		}
+		index.add(indexed)
+	}
+	return index, nil
+}
+
+// Writes the records as lines of the index.
+func marshalIndexedRecords(records Records) ([]byte, error) {
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(indexRecord(record))
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return data, nil
+}
+
+// A task or audit record a search found.
+type SearchResult struct {
+	// One of these is set
+	Task   *Task
+	Record *Record
+	// Higher is a better match
+	Score float64
+	// The words in it that matched, lower case, to highlight
+	Matched map[string]bool
+}
+
+// The result as it's usually shown, with the words that matched
+// highlighted.
+func (result SearchResult) String() string {
+	if result.Task != nil {
+		return highlightWords(result.Task.String(), result.Matched)
+	}
+	return highlightWords(result.Record.String(), result.Matched)
+}
+
+// Finds the tasks and audit records with every word in the search, in
+// their body, annotation or tags. Words match exactly, as the start of a
+// word or anywhere in one, or, failing that, with a typo or two. Results
+// are best first, tasks before records, and newer records before older
+// ones that match as well. At most SEARCH_RECORD_LIMIT records are
+// returned, along with how many matched.
+//
+// Only what's listed for the manager's category is searched.
+func (manager *TaskManager) Search(search string) (tasks []SearchResult,
+	records []SearchResult, matchedRecords int, err error) {
+	searchWords := uniqueWords(search)
+	if len(searchWords) == 0 {
+		return nil, nil, 0, errors.New("Nothing to search for")
+	}
+
+	allTasks, err := manager.GetTasks()
+	if err != nil && !IsCorrupt(err) {
+		return nil, nil, 0, err
+	}
+	for i := range allTasks {
+		task := allTasks[i]
+		words := make(map[string][]int)
+		texts := []string{task.BodyContent, task.Description, strings.Join(task.Tags, " ")}
+		for _, item := range task.Checklist {
+			texts = append(texts, item.Body)
+		}
+		for _, word := range uniqueWords(texts...) {
+			words[word] = []int{0}
+		}
+		if scores := matchWords(searchWords, words); len(scores) != 0 {
+			tasks = append(tasks, SearchResult{Task: &task, Score: scores[0].score,
+				Matched: scores[0].matched})
+		}
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Score > tasks[j].Score
+	})
+
+	unlock, err := manager.Lock()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer unlock()
+	index, err := manager.loadSearchIndex()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for position, match := range matchWords(searchWords, index.Words) {
+		record, err := index.Records[position].record()
+		if err != nil || !manager.listed(record.Category) {
+			continue
+		}
+		records = append(records, SearchResult{Record: &record, Score: match.score,
+			Matched: match.matched})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Score != records[j].Score {
+			return records[i].Score > records[j].Score
+		}
+		return records[i].Record.DateCompleted.After(records[j].Record.DateCompleted)
+	})
+	matchedRecords = len(records)
+	if len(records) > SEARCH_RECORD_LIMIT {
+		records = records[:SEARCH_RECORD_LIMIT]
+	}
+	return tasks, records, matchedRecords, nil
+}
+
+// Builds the search index again from the audit logs, in case it's out of
+// date, e.g. after audit logs were changed by hand.
+func (manager *TaskManager) ReindexSearch() error {
+	unlock, err := manager.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := manager.dropSearchIndex(); err != nil {
+		return err
+	}
+	_, err = manager.loadSearchIndex()
+	return err
+}
+
+// Reads the search index, building it if there isn't one. The store should
+// be locked.
+func (manager *TaskManager) loadSearchIndex() (*searchIndex, error) {
+	data, err := manager.store().ReadMeta(SEARCH_INDEX)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != 0 {
+		if index, err := parseSearchIndex(data); err == nil {
+			return index, nil
+		}
+		LogError("Rebuilding unreadable search index")
+	}
+	records, err := manager.store().ListRecords()
+	if err != nil {
+		return nil, err
+	}
+	index := &searchIndex{Words: make(map[string][]int)}
+	for _, record := range records {
+		index.add(indexRecord(record))
+	}
+	if data, err = marshalIndexedRecords(records); err != nil {
+		return nil, err
+	}
+	return index, manager.store().WriteMeta(SEARCH_INDEX, data)
+}
+
+// Adds records that were just logged to the search index, if there is one
+// yet, without reading the rest of it. The store should be locked.
+func (manager *TaskManager) indexRecords(records Records) error {
+	data, err := marshalIndexedRecords(records)
+	if err != nil {
+		return err
+	}
+	return manager.store().AppendMeta(SEARCH_INDEX, data)
+}
+
+// Throws the search index away, so it's built again when it's next needed.
+// The store should be locked.
+func (manager *TaskManager) dropSearchIndex() error {
+	return manager.store().WriteMeta(SEARCH_INDEX, nil)
+}
+
+// How well a task or record matched a search.
+type wordMatch struct {
+	score   float64
+	matched map[string]bool
+}
+
+// Scores what has every word in the search, given the words it's looking
+// through and where each of them is.
+func matchWords(searchWords []string, words map[string][]int) map[int]wordMatch {
+	var matches map[int]wordMatch
+	for _, searchWord := range searchWords {
+		// The best each position does for this search word
+		best := make(map[int]float64)
+		matched := make(map[int][]string)
+		for word, positions := range words {
+			score := wordScore(searchWord, word)
+			if score == 0 {
+				continue
+			}
+			for _, position := range positions {
+				if score > best[position] {
+					best[position] = score
+				}
+				matched[position] = append(matched[position], word)
+			}
+		}
+		// Everything has to have each word
+		next := make(map[int]wordMatch)
+		for position, score := range best {
+			match, exists := matches[position]
+			if matches != nil && !exists {
+				continue
+			}
+			if match.matched == nil {
+				match.matched = make(map[string]bool)
+			}
+			match.score += score
+			for _, word := range matched[position] {
+				match.matched[word] = true
+			}
+			next[position] = match
+		}
+		matches = next
+	}
+	return matches
+}
+
+// How well a word matches a search word, 0 being not at all.
+func wordScore(searchWord, word string) float64 {
+	switch {
+	case word == searchWord:
+		return 4
+	case strings.HasPrefix(word, searchWord):
+		return 3
+	case strings.Contains(word, searchWord):
+		return 2
+	}
+	// Allow for typos, more of them in longer words
+	allowed := 0
+	if length := len([]rune(searchWord)); length >= 8 {
+		allowed = 2
+	} else if length >= 4 {
+		allowed = 1
+	}
+	if allowed == 0 {
+		return 0
+	}
+	if distance := editDistance(searchWord, word, allowed); distance <= allowed {
+		return 1.5 - 0.5*float64(distance)
+	}
+	return 0
+}
+
+// The number of single letter changes between two words, or more than max
+// if it's more than max.
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// The distinct words in the texts, lower case.
+func uniqueWords(texts ...string) []string {
+	seen := make(map[string]bool)
+	var words []string
+	for _, text := range texts {
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), isWordSeparator) {
+			if !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
+
+func isWordSeparator(c rune) bool {
+	return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+}
+
+// Highlights the words in the text that are in the set, lower case.
+func highlightWords(text string, words map[string]bool) string {
+	var highlighted strings.Builder
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := text[start:end]
+		if words[strings.ToLower(word)] {
+			highlighted.WriteString(colorize(currentDisplay().Theme.Highlight, word))
+		} else {
+			highlighted.WriteString(word)
+		}
+		start = -1
+	}
+	for i, c := range text {
+		if isWordSeparator(c) {
+			flush(i)
+			highlighted.WriteRune(c)
+		} else if start < 0 {
+			start = i
+		}
+	}
+	flush(len(text))
+	return highlighted.String()
+}
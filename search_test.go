@@ -0,0 +1,244 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+// Logs records of the bodies being done a day apart, the first the given
+// number of days after testClock.
+func logTestRecords(t *testing.T, manager *TaskManager, category string, days int, bodies ...string) {
+	unlock, err := manager.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	var tx Transaction
+	for i, body := range bodies {
+		done := testClock.Now().AddDate(0, 0, days+i)
+		tx.Records = append(tx.Records, NewRecord(testTask(t, body, category), done, ""))
+	}
+	if err := manager.Commit(tx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The bodies of the results, in order.
+func resultBodies(results []SearchResult) []string {
+	var bodies []string
+	for _, result := range results {
+		if result.Task != nil {
+			bodies = append(bodies, result.Task.BodyContent)
+		} else {
+			bodies = append(bodies, result.Record.BodyContent)
+		}
+	}
+	return bodies
+}
+
+func TestSearch(t *testing.T) {
+	manager := &TaskManager{Store: NewMemoryStore(), Clock: testClock}
+	for _, body := range []string{"buy milk", "plan holiday"} {
+		task := testTask(t, body, "")
+		if err := manager.SaveTask(&task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logTestRecords(t, manager, "", 0, "buy milk", "milkshake", "holiday photos", "buy milk")
+	logTestRecords(t, manager, "work", 4, "buy printer paper")
+
+	tests := []struct {
+		search  string
+		tasks   []string
+		records []string
+	}{
+		// Newer records come first when they match as well
+		{"milk", []string{"buy milk"}, []string{"buy milk", "buy milk", "milkshake"}},
+		{"BUY", []string{"buy milk"}, []string{"buy printer paper", "buy milk", "buy milk"}},
+		// Every word has to match
+		{"buy milk", []string{"buy milk"}, []string{"buy milk", "buy milk"}},
+		{"holliday", []string{"plan holiday"}, []string{"holiday photos"}},
+		{"shake", nil, []string{"milkshake"}},
+		{"printer", nil, []string{"buy printer paper"}},
+		{"nothing", nil, nil},
+	}
+	for _, test := range tests {
+		tasks, records, matched, err := manager.Search(test.search)
+		if err != nil {
+			t.Errorf("Search(%q): %v", test.search, err)
+			continue
+		}
+		if got := resultBodies(tasks); !equalStrings(got, test.tasks) {
+			t.Errorf("Search(%q) found tasks %v, want %v", test.search, got, test.tasks)
+		}
+		if got := resultBodies(records); !equalStrings(got, test.records) || matched != len(test.records) {
+			t.Errorf("Search(%q) found records %v (%d matched), want %v",
+				test.search, got, matched, test.records)
+		}
+	}
+
+	if _, _, _, err := manager.Search(" - "); err == nil {
+		t.Error("Search of no words should fail")
+	}
+
+	// Only what's listed for the category is searched
+	work := &TaskManager{Store: manager.Store, Clock: testClock, Category: "work"}
+	_, records, _, err := work.Search("buy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultBodies(records), []string{"buy printer paper"}; !equalStrings(got, want) {
+		t.Errorf("Search in work found %v, want %v", got, want)
+	}
+}
+
+func TestSearchRecordLimit(t *testing.T) {
+	manager := &TaskManager{Store: NewMemoryStore(), Clock: testClock}
+	var bodies []string
+	for i := 0; i < SEARCH_RECORD_LIMIT+10; i++ {
+		bodies = append(bodies, fmt.Sprintf("water plants %d", i))
+	}
+	logTestRecords(t, manager, "", 0, bodies...)
+	_, records, matched, err := manager.Search("water")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != SEARCH_RECORD_LIMIT || matched != SEARCH_RECORD_LIMIT+10 {
+		t.Errorf("found %d records of %d matched, want %d of %d",
+			len(records), matched, SEARCH_RECORD_LIMIT, SEARCH_RECORD_LIMIT+10)
+	}
+	if newest := records[0].Record.BodyContent; newest != bodies[len(bodies)-1] {
+		t.Errorf("first record found is %q, want the newest", newest)
+	}
+}
+
+// Records logged after the index is built are appended to it, for every
+// kind of store.
+func TestSearchIndexUpdates(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			manager := &TaskManager{Store: store, Clock: testClock}
+			logTestRecords(t, manager, "", 0, "feed cat")
+			if _, records, _, err := manager.Search("cat"); err != nil || len(records) != 1 {
+				t.Fatalf("Search(\"cat\") found %d records, %v", len(records), err)
+			}
+			logTestRecords(t, manager, "pets", 1, "walk dog", "brush cat")
+			data, err := store.ReadMeta(SEARCH_INDEX)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := bytes.Count(data, []byte("\n")); lines != 3 {
+				t.Errorf("search index has %d lines, want one for each of the 3 records", lines)
+			}
+			_, records, _, err := manager.Search("cat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := resultBodies(records), []string{"brush cat", "feed cat"}; !equalStrings(got, want) {
+				t.Errorf("Search(\"cat\") found %v, want %v", got, want)
+			}
+
+			// An index that can't be read is built again
+			if err := store.WriteMeta(SEARCH_INDEX, []byte("{\"Records\": []}")); err != nil {
+				t.Fatal(err)
+			}
+			if _, records, _, err := manager.Search("dog"); err != nil || len(records) != 1 {
+				t.Errorf("Search(\"dog\") with a bad index found %d records, %v", len(records), err)
+			}
+
+			// Moving a category drops the index, as records are indexed
+			// under their category
+			if err := manager.RenameCategory("pets", "animals"); err != nil {
+				t.Fatal(err)
+			}
+			animals := &TaskManager{Store: store, Clock: testClock, Category: "animals"}
+			if _, records, _, err := animals.Search("dog"); err != nil || len(records) != 1 {
+				t.Errorf("Search(\"dog\") in animals found %d records, %v", len(records), err)
+			}
+		})
+	}
+}
+
+func TestAuditLogIndexed(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			manager := &TaskManager{Store: store, Clock: testClock}
+			logTestRecords(t, manager, "", 0, "feed cat")
+			if _, _, _, err := manager.Search("cat"); err != nil {
+				t.Fatal(err)
+			}
+			done := testClock.Now().AddDate(0, 0, 1)
+			if err := manager.AuditLog(testTask(t, "brush cat", ""), done, ""); err != nil {
+				t.Fatal(err)
+			}
+			_, records, _, err := manager.Search("cat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := resultBodies(records), []string{"brush cat", "feed cat"}; !equalStrings(got, want) {
+				t.Errorf("Search(\"cat\") found %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSearchIndexAfterJournalReplay(t *testing.T) {
+	store := NewDirectoryStore(t.TempDir())
+	manager := &TaskManager{Store: store, Clock: testClock}
+	logTestRecords(t, manager, "", 0, "feed cat")
+	if _, _, _, err := manager.Search("cat"); err != nil {
+		t.Fatal(err)
+	}
+	// A commit interrupted once its journal was written
+	record := NewRecord(testTask(t, "brush cat", ""), testClock.Now().AddDate(0, 0, 1), "")
+	info, err := os.Stat(path.Join(store.categoryDir(""), AUDIT_LOG))
+	if err != nil {
+		t.Fatal(err)
+	}
+	journalJson, err := json.Marshal(journal{
+		Records:       []journalRecord{{record.Category, record.Marshal()}},
+		AuditLogSizes: map[string]int64{"": info.Size()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(store.journalPath(), journalJson); err != nil {
+		t.Fatal(err)
+	}
+	_, records, _, err := manager.Search("cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultBodies(records), []string{"brush cat", "feed cat"}; !equalStrings(got, want) {
+		t.Errorf("Search(\"cat\") after replaying the journal found %v, want %v", got, want)
+	}
+}
+
+func TestWordScore(t *testing.T) {
+	tests := []struct {
+		search, word string
+		want         float64
+	}{
+		{"milk", "milk", 4},
+		{"milk", "milkshake", 3},
+		{"shake", "milkshake", 2},
+		{"milk", "silk", 1},
+		{"milk", "salt", 0},
+		{"tomorow", "tomorrow", 1},
+		{"holliday", "holiday", 1},
+		{"hollidai", "holiday", 0.5},
+		// Swapping letters is two typos, too many for a word this short
+		{"holdiay", "holiday", 0},
+		// Too short for typos
+		{"cat", "cut", 0},
+	}
+	for _, test := range tests {
+		if got := wordScore(test.search, test.word); got != test.want {
+			t.Errorf("wordScore(%q, %q) = %v, want %v", test.search, test.word, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package todo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	_ "modernc.org/sqlite"
+)
+
+const SQLITE_SCHEMA = `
+CREATE TABLE IF NOT EXISTS categories (
+	name TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS tasks (
+	id       TEXT PRIMARY KEY,
+	category TEXT NOT NULL DEFAULT '',
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS records (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	category TEXT NOT NULL DEFAULT '',
+	fields   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS meta (
+	key  TEXT PRIMARY KEY,
+	data BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS meta_appends (
+	id   INTEGER PRIMARY KEY AUTOINCREMENT,
+	key  TEXT NOT NULL,
+	data BLOB NOT NULL
+);
+`
+
+// Set on every connection. Rather than failing straight away when another
+// process is writing, wait up to 5 seconds for it, and with write-ahead
+// logging readers don't have to wait for writers at all.
+const SQLITE_PRAGMAS = "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+// A Store backed by a single SQLite database file.
+//
+// Tasks are kept as the same JSON the DirectoryStore writes and audit
+// records as the same fields written to an audit_log, so nothing is lost
+// moving between the two.
+type SQLiteStore struct {
+	db       *sql.DB
+	fileName string
+}
+
+func NewSQLiteStore(fileName string) (*SQLiteStore, error) {
+	separator := "?"
+	if strings.Contains(fileName, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", fileName+separator+SQLITE_PRAGMAS)
+	if err != nil {
+		return nil, err
+	}
+	store := &SQLiteStore{db: db, fileName: fileName}
+	// Another process opening the database at the same time would otherwise
+	// race to create the schema
+	unlock, err := store.Lock()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	defer unlock()
+	// Tasks used to be keyed by their full index, which is now their ID.
+	var legacy int
+	err = db.QueryRow("SELECT count(*) FROM pragma_table_info('tasks') " +
+		"WHERE name = 'full_index'").Scan(&legacy)
+	if err == nil && legacy != 0 {
+		_, err = db.Exec("ALTER TABLE tasks RENAME COLUMN full_index TO id")
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(SQLITE_SCHEMA); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *SQLiteStore) Close() error {
+	return store.db.Close()
+}
+
+// SQLite already serializes writes, and with SQLITE_PRAGMAS reads and
+// writes wait for each other rather than failing. The lock is only needed to
+// keep reading and then writing a task from racing with another process.
+func (store *SQLiteStore) Lock() (func(), error) {
+	file, err := lockFile(store.fileName + "." + LOCK_FILE)
+	if err != nil {
+		return nil, err
+	}
+	return func() { file.Close() }, nil
+}
+
+func scanTask(rows interface{ Scan(...interface{}) error }) (*Task, error) {
+	var id, category, data string
+	if err := rows.Scan(&id, &category, &data); err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(data), &task); err != nil {
+		return nil, &CorruptTaskError{Path: id, Err: err}
+	}
+	task.ID = id
+	task.setIndex()
+	if category != "" {
+		task.category = &category
+	}
+	return &task, nil
+}
+
+func (store *SQLiteStore) ListTasks() (Tasks, error) {
+	rows, err := store.db.Query("SELECT id, category, data FROM tasks")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tasks Tasks
+	var corrupt CorruptTasksError
+	for rows.Next() {
+		task, err := scanTask(rows)
+		var corruptTask *CorruptTaskError
+		if errors.As(err, &corruptTask) {
+			corrupt = append(corrupt, corruptTask)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, *task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(corrupt) != 0 {
+		return tasks, corrupt
+	}
+	return tasks, nil
+}
+
+func (store *SQLiteStore) GetTask(id string) (*Task, error) {
+	row := store.db.QueryRow(
+		"SELECT id, category, data FROM tasks WHERE id = ?", id)
+	task, err := scanTask(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return task, err
+}
+
+// Either the database or a transaction in it.
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (store *SQLiteStore) PutTask(task Task) error {
+	return putSQLiteTask(store.db, task)
+}
+
+func putSQLiteTask(db sqlExecer, task Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	if err := createSQLiteCategory(db, task.Category()); err != nil {
+		return err
+	}
+	_, err = db.Exec(
+		"INSERT OR REPLACE INTO tasks (id, category, data) VALUES (?, ?, ?)",
+		task.ID, task.Category(), string(data))
+	return err
+}
+
+func (store *SQLiteStore) DeleteTask(task Task) error {
+	return deleteSQLiteTask(store.db, task)
+}
+
+func deleteSQLiteTask(db sqlExecer, task Task) error {
+	_, err := db.Exec("DELETE FROM tasks WHERE id = ?", task.ID)
+	return err
+}
+
+func (store *SQLiteStore) ListCategories() ([]string, error) {
+	rows, err := store.db.Query("SELECT name FROM categories ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var categories []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		categories = append(categories, name)
+	}
+	return categories, rows.Err()
+}
+
+func (store *SQLiteStore) CreateCategory(name string) error {
+	return createSQLiteCategory(store.db, name)
+}
+
+func createSQLiteCategory(db sqlExecer, name string) error {
+	if name == "" {
+		return nil
+	}
+	_, err := db.Exec("INSERT OR IGNORE INTO categories (name) VALUES (?)", name)
+	return err
+}
+
+// Matches a category, and the categories nested in it, in a column named
+// category. Takes the category twice, then its length plus one.
+const SQLITE_IN_CATEGORY = "(category = ? OR substr(category, 1, ?) = ? || '/')"
+
+func (store *SQLiteStore) MoveCategory(from, to string) (err error) {
+	sqlTx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			sqlTx.Rollback()
+		}
+	}()
+	// The destination may already exist, so the categories are inserted
+	// rather than renamed.
+	for _, query := range []string{
+		"INSERT OR IGNORE INTO categories (name) " +
+			"SELECT ? || substr(name, ?) FROM categories WHERE " +
+			strings.Replace(SQLITE_IN_CATEGORY, "category", "name", -1),
+		"UPDATE tasks SET category = ? || substr(category, ?) WHERE " + SQLITE_IN_CATEGORY,
+		"UPDATE records SET category = ? || substr(category, ?) WHERE " + SQLITE_IN_CATEGORY,
+	} {
+		_, err := sqlTx.Exec(query, to, sqliteLength(from)+1, from, sqliteLength(from)+1, from)
+		if err != nil {
+			return err
+		}
+	}
+	if err := deleteSQLiteCategory(sqlTx, from); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+func (store *SQLiteStore) DeleteCategory(name string) (err error) {
+	sqlTx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			sqlTx.Rollback()
+		}
+	}()
+	for _, query := range []string{
+		"DELETE FROM tasks WHERE " + SQLITE_IN_CATEGORY,
+		"DELETE FROM records WHERE " + SQLITE_IN_CATEGORY,
+	} {
+		if _, err := sqlTx.Exec(query, name, sqliteLength(name)+1, name); err != nil {
+			return err
+		}
+	}
+	if err := deleteSQLiteCategory(sqlTx, name); err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+func deleteSQLiteCategory(db sqlExecer, name string) error {
+	_, err := db.Exec("DELETE FROM categories WHERE "+
+		strings.Replace(SQLITE_IN_CATEGORY, "category", "name", -1),
+		name, sqliteLength(name)+1, name)
+	return err
+}
+
+// SQLite's substr counts characters, not bytes.
+func sqliteLength(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+func (store *SQLiteStore) AppendRecord(record Record) error {
+	return appendSQLiteRecord(store.db, record)
+}
+
+func appendSQLiteRecord(db sqlExecer, record Record) error {
+	fields, err := json.Marshal(record.Marshal())
+	if err != nil {
+		return err
+	}
+	if err := createSQLiteCategory(db, record.Category); err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO records (category, fields) VALUES (?, ?)",
+		record.Category, string(fields))
+	return err
+}
+
+// Whatever was appended to meta is kept in its own rows, so appending
+// doesn't rewrite what's already there.
+func (store *SQLiteStore) ReadMeta(key string) ([]byte, error) {
+	var data []byte
+	err := store.db.QueryRow("SELECT data FROM meta WHERE key = ?", key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rows, err := store.db.Query("SELECT data FROM meta_appends WHERE key = ? ORDER BY id", key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var appended []byte
+		if err := rows.Scan(&appended); err != nil {
+			return nil, err
+		}
+		data = append(data, appended...)
+	}
+	return data, rows.Err()
+}
+
+func (store *SQLiteStore) WriteMeta(key string, data []byte) (err error) {
+	sqlTx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			sqlTx.Rollback()
+		}
+	}()
+	if _, err := sqlTx.Exec("DELETE FROM meta_appends WHERE key = ?", key); err != nil {
+		return err
+	}
+	// Writing nothing, e.g. to drop the search index, leaves no row
+	if len(data) == 0 {
+		_, err = sqlTx.Exec("DELETE FROM meta WHERE key = ?", key)
+	} else {
+		_, err = sqlTx.Exec("INSERT OR REPLACE INTO meta (key, data) VALUES (?, ?)", key, data)
+	}
+	if err != nil {
+		return err
+	}
+	return sqlTx.Commit()
+}
+
+func (store *SQLiteStore) AppendMeta(key string, data []byte) error {
+	_, err := store.db.Exec("INSERT INTO meta_appends (key, data) SELECT ?, ? "+
+		"WHERE EXISTS (SELECT 1 FROM meta WHERE key = ? AND length(data) != 0)",
+		key, data, key)
+	return err
+}
+
+func (store *SQLiteStore) ListRecords() (Records, error) {
+	rows, err := store.db.Query("SELECT category, fields FROM records ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records Records
+	for rows.Next() {
+		var category, data string
+		if err := rows.Scan(&category, &data); err != nil {
+			return nil, err
+		}
+		var fields []string
+		if err := json.Unmarshal([]byte(data), &fields); err != nil {
+			return nil, err
+		}
+		record, err := Unmarshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		record.Category = category
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,131 @@
+package todo
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMigrateStore(t *testing.T) {
+	from := NewDirectoryStore(t.TempDir())
+	tasks := Tasks{testTask(t, "buy milk", ""), testTask(t, "fix sink", "home/repairs")}
+	for _, category := range []string{"home", "home/repairs"} {
+		if err := from.CreateCategory(category); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, task := range tasks {
+		if err := from.PutTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Logged out of order, which migrating keeps
+	for i, body := range []string{"water plants", "call bob"} {
+		done := time.Date(2026, 10, 18-i, 9, 0, 0, 0, time.UTC)
+		if err := from.AppendRecord(NewRecord(testTask(t, body, "home"), done, "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	to, err := NewSQLiteStore(path.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	if err := MigrateStore(from, to); err != nil {
+		t.Fatal(err)
+	}
+	categories, err := to.ListCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"home", "home/repairs"}; !equalStrings(categories, want) {
+		t.Errorf("migrated categories %v, want %v", categories, want)
+	}
+	migrated, err := to.ListTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := taskBodies(migrated), taskBodies(tasks); !equalStrings(got, want) {
+		t.Errorf("migrated tasks %v, want %v", got, want)
+	}
+	records, err := to.ListRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bodies []string
+	for _, record := range records {
+		bodies = append(bodies, record.BodyContent)
+	}
+	if want := []string{"water plants", "call bob"}; !equalStrings(bodies, want) {
+		t.Errorf("migrated records %v, want %v", bodies, want)
+	}
+
+	if err := MigrateStore(from, to); err == nil {
+		t.Error("migrating into a store that has tasks should fail")
+	}
+}
+
+// Every process opens the database for itself, and creating a task while
+// another lists them shouldn't fail as the database is busy.
+func TestSQLiteStoreConcurrentAccess(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "todo.db")
+	const WRITERS = 20
+	var tasks []Task
+	for i := 0; i < WRITERS; i++ {
+		tasks = append(tasks, testTask(t, fmt.Sprintf("task %d", i), ""))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < WRITERS; i++ {
+		wg.Add(2)
+		go func(task Task) {
+			defer wg.Done()
+			store, err := NewSQLiteStore(fileName)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer store.Close()
+			unlock, err := store.Lock()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			if _, err := store.ListTasks(); err != nil {
+				t.Error(err)
+			}
+			if err := store.PutTask(task); err != nil {
+				t.Error(err)
+			}
+		}(tasks[i])
+		go func() {
+			defer wg.Done()
+			store, err := NewSQLiteStore(fileName)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer store.Close()
+			if _, err := store.ListTasks(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	store, err := NewSQLiteStore(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	stored, err := store.ListTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != WRITERS {
+		t.Errorf("stored %d tasks, want %d", len(stored), WRITERS)
+	}
+}
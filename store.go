@@ -0,0 +1,531 @@
+package todo
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+const TASK_EXTENSION = ".todo"
+const LOCK_FILE = "lock"
+const SQLITE_EXTENSION = ".db"
+const META_EXTENSION = ".meta"
+
+// A Store persists tasks, categories and the audit log.
+//
+// Tasks are identified by their ID. A task's category is carried in the
+// task itself, the empty category being the "root" of the store.
+type Store interface {
+	// Lists every task in every category.
+	ListTasks() (Tasks, error)
+	// Gets a task by its ID. Returns nil if there is no such task.
+	GetTask(id string) (*Task, error)
+	// Saves a task, overwriting any task with the same ID.
+	PutTask(task Task) error
+	// Removes a task.
+	DeleteTask(task Task) error
+	// Lists the names of every category.
+	ListCategories() ([]string, error)
+	// Creates a category if it does not already exist.
+	CreateCategory(name string) error
+	// Moves a category, along with the categories nested in it, their
+	// tasks and audit logs. If the destination already exists the two are
+	// merged. The store should be locked.
+	MoveCategory(from, to string) error
+	// Removes a category, along with the categories nested in it, their
+	// tasks and audit logs. The store should be locked.
+	DeleteCategory(name string) error
+	// Appends a record to the audit log of the record's category.
+	AppendRecord(record Record) error
+	// Lists the audit records of every category.
+	ListRecords() (Records, error)
+	// Makes every change in the transaction, or none of them. The store
+	// should be locked, so the transaction is based on what is stored.
+	Commit(tx Transaction) error
+	// Waits for exclusive use of the store, across goroutines and
+	// processes, until unlock is called.
+	Lock() (unlock func(), err error)
+	// Reads bookkeeping that isn't part of any task, e.g. which reminders
+	// have fired. Returns nil if nothing was written under the key.
+	ReadMeta(key string) ([]byte, error)
+	// Replaces whatever was written under the key.
+	WriteMeta(key string, data []byte) error
+	// Adds to the end of what was written under the key, without
+	// rewriting it. Does nothing if nothing was, so e.g. an index is only
+	// kept up to date once it's been built.
+	AppendMeta(key string, data []byte) error
+}
+
+// The default store: one JSON file per task, with each category being a
+// subdirectory of the root with its own audit log.
+//
+//	<root>/<id>.todo
+//	<root>/audit_log
+//	<root>/<category>/<id>.todo
+//	<root>/<category>/audit_log
+//	<root>/<category>/<nested category>/...
+//	<root>/<key>.meta
+//
+// Task files are replaced atomically and the audit log is synced after
+// every append. Transactions are written to <root>/journal first and
+// finished by the next use of the store if they were interrupted.
+type DirectoryStore struct {
+	Root string
+}
+
+func NewDirectoryStore(root string) *DirectoryStore {
+	return &DirectoryStore{Root: root}
+}
+
+func (store *DirectoryStore) categoryDir(category string) string {
+	return path.Join(store.Root, category)
+}
+
+func (store *DirectoryStore) taskPath(task Task) string {
+	return path.Join(store.categoryDir(task.Category()), task.ID+TASK_EXTENSION)
+}
+
+// Reads all the tasks directly inside the category directory. Tasks that
+// can't be read are skipped and returned separately.
+func (store *DirectoryStore) readTasks(category string) (Tasks, CorruptTasksError, error) {
+	dir := store.categoryDir(category)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tasks Tasks
+	var corrupt CorruptTasksError
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), TASK_EXTENSION) {
+			continue
+		}
+		task, err := store.readTask(category, file.Name())
+		if err != nil {
+			corrupt = append(corrupt, &CorruptTaskError{
+				Path: path.Join(dir, file.Name()),
+				Err:  err,
+			})
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+	return tasks, corrupt, nil
+}
+
+func (store *DirectoryStore) readTask(category, fileName string) (*Task, error) {
+	bytes, err := ioutil.ReadFile(path.Join(store.categoryDir(category), fileName))
+	if err != nil {
+		return nil, err
+	}
+	var task Task
+	if err := json.Unmarshal(bytes, &task); err != nil {
+		return nil, err
+	}
+	// Older tasks don't store their ID, it's the name of their file.
+	if task.ID == "" {
+		task.ID = strings.TrimSuffix(fileName, TASK_EXTENSION)
+	}
+	task.setIndex()
+	if category != "" {
+		categoryName := category
+		task.category = &categoryName
+	}
+	return &task, nil
+}
+
+func (store *DirectoryStore) ListTasks() (Tasks, error) {
+	if err := createDir(store.Root); err != nil {
+		return nil, err
+	}
+	categories, err := store.ListCategories()
+	if err != nil {
+		return nil, err
+	}
+	var tasks Tasks
+	var corrupt CorruptTasksError
+	for _, category := range append([]string{""}, categories...) {
+		categoryTasks, categoryCorrupt, err := store.readTasks(category)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, categoryTasks...)
+		corrupt = append(corrupt, categoryCorrupt...)
+	}
+	if len(corrupt) != 0 {
+		return tasks, corrupt
+	}
+	return tasks, nil
+}
+
+func (store *DirectoryStore) GetTask(id string) (*Task, error) {
+	categories, err := store.ListCategories()
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range append([]string{""}, categories...) {
+		fileName := id + TASK_EXTENSION
+		filePath := path.Join(store.categoryDir(category), fileName)
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			continue
+		}
+		task, err := store.readTask(category, fileName)
+		if err != nil {
+			return nil, &CorruptTaskError{Path: filePath, Err: err}
+		}
+		return task, nil
+	}
+	return nil, nil
+}
+
+func (store *DirectoryStore) PutTask(task Task) error {
+	if err := store.CreateCategory(task.Category()); err != nil {
+		return err
+	}
+	taskJson, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.taskPath(task), taskJson)
+}
+
+func (store *DirectoryStore) DeleteTask(task Task) error {
+	if err := os.Remove(store.taskPath(task)); err != nil {
+		return err
+	}
+	return syncDir(store.categoryDir(task.Category()))
+}
+
+func (store *DirectoryStore) Lock() (func(), error) {
+	if err := createDir(store.Root); err != nil {
+		return nil, err
+	}
+	file, err := lockFile(path.Join(store.Root, LOCK_FILE))
+	if err != nil {
+		return nil, err
+	}
+	// Whoever had the lock before may have been interrupted mid commit
+	if err := store.recoverLocked(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() { file.Close() }, nil
+}
+
+func (store *DirectoryStore) ListCategories() ([]string, error) {
+	if err := createDir(store.Root); err != nil {
+		return nil, err
+	}
+	return store.listCategories("")
+}
+
+// Lists the categories nested in a category, at any depth.
+func (store *DirectoryStore) listCategories(parent string) ([]string, error) {
+	files, err := ioutil.ReadDir(store.categoryDir(parent))
+	if err != nil {
+		return nil, err
+	}
+	var categories []string
+	for _, file := range files {
+		if !file.IsDir() {
+			continue
+		}
+		category := path.Join(parent, file.Name())
+		nested, err := store.listCategories(category)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+		categories = append(categories, nested...)
+	}
+	return categories, nil
+}
+
+func (store *DirectoryStore) CreateCategory(name string) error {
+	if err := createDir(store.Root); err != nil {
+		return err
+	}
+	return os.MkdirAll(store.categoryDir(name), 0700)
+}
+
+func (store *DirectoryStore) MoveCategory(from, to string) error {
+	toDir := store.categoryDir(to)
+	if err := os.MkdirAll(path.Dir(toDir), 0700); err != nil {
+		return err
+	}
+	if err := mergeDir(store.categoryDir(from), toDir); err != nil {
+		return err
+	}
+	if err := syncDir(path.Dir(store.categoryDir(from))); err != nil {
+		return err
+	}
+	return syncDir(path.Dir(toDir))
+}
+
+// Moves everything in one category directory into another. Task files and
+// nested categories are renamed into place, audit logs are appended to
+// the destination's.
+func mergeDir(fromDir, toDir string) error {
+	if _, err := os.Stat(toDir); os.IsNotExist(err) {
+		return os.Rename(fromDir, toDir)
+	} else if err != nil {
+		return err
+	}
+	files, err := ioutil.ReadDir(fromDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fromPath := path.Join(fromDir, file.Name())
+		toPath := path.Join(toDir, file.Name())
+		if file.IsDir() {
+			err = mergeDir(fromPath, toPath)
+		} else if file.Name()+"/" == AUDIT_LOG {
+			err = mergeAuditLog(fromPath, toPath)
+		} else if strings.HasSuffix(file.Name(), TASK_EXTENSION) {
+			err = os.Rename(fromPath, toPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := syncDir(toDir); err != nil {
+		return err
+	}
+	// Anything left over, e.g. temporary files, isn't worth keeping
+	return os.RemoveAll(fromDir)
+}
+
+// Appends the records of one audit log to another, then removes the first.
+func mergeAuditLog(fromPath, toPath string) error {
+	from, err := ioutil.ReadFile(fromPath)
+	if err != nil {
+		return err
+	}
+	to, err := ioutil.ReadFile(toPath)
+	if os.IsNotExist(err) {
+		return os.Rename(fromPath, toPath)
+	} else if err != nil {
+		return err
+	}
+	// Both start with the same header, only keep the destination's
+	from = []byte(strings.TrimPrefix(string(from), "#"+AUDIT_FIELDS))
+	if err := writeFileAtomic(toPath, append(to, from...)); err != nil {
+		return err
+	}
+	return os.Remove(fromPath)
+}
+
+func (store *DirectoryStore) DeleteCategory(name string) error {
+	if err := os.RemoveAll(store.categoryDir(name)); err != nil {
+		return err
+	}
+	return syncDir(path.Dir(store.categoryDir(name)))
+}
+
+func (store *DirectoryStore) ReadMeta(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path.Join(store.Root, key+META_EXTENSION))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (store *DirectoryStore) WriteMeta(key string, data []byte) error {
+	if err := createDir(store.Root); err != nil {
+		return err
+	}
+	return writeFileAtomic(path.Join(store.Root, key+META_EXTENSION), data)
+}
+
+func (store *DirectoryStore) AppendMeta(key string, data []byte) error {
+	metaFile, err := os.OpenFile(path.Join(store.Root, key+META_EXTENSION),
+		os.O_APPEND|os.O_WRONLY, 0600)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer metaFile.Close()
+	info, err := metaFile.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	if _, err := metaFile.Write(data); err != nil {
+		return err
+	}
+	return metaFile.Sync()
+}
+
+func (store *DirectoryStore) AppendRecord(record Record) error {
+	return store.appendFields(record.Category, record.Marshal())
+}
+
+// Appends a marshalled record to a category's audit log and syncs it.
+func (store *DirectoryStore) appendFields(category string, fields []string) error {
+	if err := store.CreateCategory(category); err != nil {
+		return err
+	}
+	auditLogPath := path.Join(store.categoryDir(category), AUDIT_LOG)
+	perms := os.O_APPEND | os.O_WRONLY | os.O_CREATE
+	auditLogFile, err := os.OpenFile(auditLogPath, perms, 0600)
+	if err != nil {
+		return err
+	}
+	defer auditLogFile.Close()
+	info, err := auditLogFile.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := auditLogFile.WriteString("#" + AUDIT_FIELDS); err != nil {
+			return err
+		}
+	}
+
+	audit_log := csv.NewWriter(auditLogFile)
+	if err := audit_log.Write(fields); err != nil {
+		return err
+	}
+	audit_log.Flush()
+	if err := audit_log.Error(); err != nil {
+		return err
+	}
+	return auditLogFile.Sync()
+}
+
+func (store *DirectoryStore) readRecords(category string) (Records, error) {
+	auditLogPath := path.Join(store.categoryDir(category), AUDIT_LOG)
+	if _, err := os.Stat(auditLogPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	auditLogFile, err := os.OpenFile(auditLogPath, os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer auditLogFile.Close()
+
+	audit_log := csv.NewReader(auditLogFile)
+	audit_log.FieldsPerRecord = -1
+	audit_log.Comment = '#'
+
+	readRecords, err := audit_log.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Corrupt audit log \"%s\": %w", auditLogPath, err)
+	}
+	var records Records
+	for _, readRecord := range readRecords {
+		record, err := Unmarshal(readRecord)
+		if err != nil {
+			return nil, fmt.Errorf("Corrupt audit log \"%s\": %w", auditLogPath, err)
+		}
+		record.Category = category
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (store *DirectoryStore) ListRecords() (Records, error) {
+	categories, err := store.ListCategories()
+	if err != nil {
+		return nil, err
+	}
+	var records Records
+	// The empty category is the root audit log
+	for _, category := range append([]string{""}, categories...) {
+		categoryRecords, err := store.readRecords(category)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, categoryRecords...)
+	}
+	return records, nil
+}
+
+// Where tasks are kept unless told otherwise: $TODO_STORAGE, or ~/.todo.
+func DefaultStorage() string {
+	if storage := os.Getenv("TODO_STORAGE"); storage != "" {
+		return storage
+	}
+	return path.Join(os.Getenv("HOME"), ".todo/")
+}
+
+// Opens the store at location. Locations ending in .db are SQLite
+// databases, anything else is a DirectoryStore.
+func OpenStore(location string) (Store, error) {
+	if strings.HasSuffix(location, SQLITE_EXTENSION) {
+		return NewSQLiteStore(location)
+	}
+	return NewDirectoryStore(location), nil
+}
+
+// Copies every category, task and audit record from one store into another.
+//
+// The destination must be empty, so that a migration can't be run twice
+// and duplicate the audit log.
+func MigrateStore(from, to Store) error {
+	existingTasks, err := to.ListTasks()
+	if err != nil {
+		return err
+	}
+	existingRecords, err := to.ListRecords()
+	if err != nil {
+		return err
+	}
+	if len(existingTasks) != 0 || len(existingRecords) != 0 {
+		return errors.New("Refusing to migrate into a store that already has tasks or records")
+	}
+
+	categories, err := from.ListCategories()
+	if err != nil {
+		return err
+	}
+	for _, category := range categories {
+		if err := to.CreateCategory(category); err != nil {
+			return err
+		}
+	}
+	tasks, err := from.ListTasks()
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if err := to.PutTask(task); err != nil {
+			return err
+		}
+	}
+	records, err := from.ListRecords()
+	if err != nil {
+		return err
+	}
+	// Keep the order records were logged in, not the order they sort in.
+	for _, record := range records {
+		if err := to.AppendRecord(record); err != nil {
+			return err
+		}
+	}
+	// So reminders don't fire all over again
+	fired, err := from.ReadMeta(FIRED_REMINDERS)
+	if err != nil || fired == nil {
+		return err
+	}
+	return to.WriteMeta(FIRED_REMINDERS, fired)
+}
+
+// Creates a directory if it does not exist
+func createDir(directoryPath string) error {
+	if _, err := os.Stat(directoryPath); os.IsNotExist(err) {
+		return os.Mkdir(directoryPath, 0700)
+	} else if err != nil {
+		return fmt.Errorf("Could not read task storage: %w", err)
+	}
+	return nil
+}
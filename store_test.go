@@ -0,0 +1,227 @@
+package todo
+
+import (
+	"path"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Every kind of store, empty.
+func testStores(t *testing.T) map[string]Store {
+	sqliteStore, err := NewSQLiteStore(path.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+	return map[string]Store{
+		"directory": NewDirectoryStore(t.TempDir()),
+		"memory":    NewMemoryStore(),
+		"sqlite":    sqliteStore,
+	}
+}
+
+// A Sunday afternoon, the day testTask's tasks are due.
+var testClock = FixedClock{Time: time.Date(2026, 10, 18, 15, 4, 0, 0, time.UTC)}
+
+// A task as TaskManager.SaveTask would save it.
+func testTask(t *testing.T, body, category string) Task {
+	due := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	task, err := NewTask(body, due, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if category != "" {
+		task.category = &category
+	}
+	task.ID = NewID()
+	task.setIndex()
+	return task
+}
+
+// The bodies of the tasks, sorted, with their categories.
+func taskBodies(tasks Tasks) []string {
+	var bodies []string
+	for _, task := range tasks {
+		bodies = append(bodies, task.Category()+":"+task.BodyContent)
+	}
+	sort.Strings(bodies)
+	return bodies
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStoreTasks(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			milk := testTask(t, "buy milk", "")
+			report := testTask(t, "write report", "work")
+			for _, task := range []Task{milk, report} {
+				if err := store.PutTask(task); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := store.GetTask(report.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || got.BodyContent != report.BodyContent || got.Category() != "work" {
+				t.Fatalf("GetTask(%s) = %v, want %v", report.ID, got, report)
+			}
+			if !got.DueDate.Equal(report.DueDate) {
+				t.Errorf("due %v, want %v", got.DueDate, report.DueDate)
+			}
+
+			if err := store.DeleteTask(milk); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.GetTask(milk.ID); err != nil || got != nil {
+				t.Errorf("GetTask of a deleted task = %v, %v, want nil", got, err)
+			}
+			tasks, err := store.ListTasks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bodies, want := taskBodies(tasks), []string{"work:write report"}; !equalStrings(bodies, want) {
+				t.Errorf("ListTasks() = %v, want %v", bodies, want)
+			}
+		})
+	}
+}
+
+func TestStoreCommit(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			task := testTask(t, "water plants", "home")
+			if err := store.PutTask(task); err != nil {
+				t.Fatal(err)
+			}
+			next := task
+			next.DueDate = task.DueDate.AddDate(0, 0, 7)
+			done := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+			tx := Transaction{
+				Delete:  Tasks{task},
+				Put:     Tasks{next},
+				Records: Records{NewRecord(task, done, "all of them")},
+			}
+			if err := store.Commit(tx); err != nil {
+				t.Fatal(err)
+			}
+			got, err := store.GetTask(task.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == nil || !got.DueDate.Equal(next.DueDate) {
+				t.Errorf("GetTask(%s) = %v, want due %v", task.ID, got, next.DueDate)
+			}
+			records, err := store.ListRecords()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 || records[0].BodyContent != "water plants" ||
+				records[0].Category != "home" || records[0].Annotation != "all of them" {
+				t.Errorf("ListRecords() = %v, want the one record", records)
+			}
+		})
+	}
+}
+
+func TestStoreCategories(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, task := range []Task{
+				testTask(t, "file taxes", "home"),
+				testTask(t, "fix sink", "home/repairs"),
+				testTask(t, "call bob", "work"),
+			} {
+				if err := store.CreateCategory(task.Category()); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.PutTask(task); err != nil {
+					t.Fatal(err)
+				}
+			}
+			unlock, err := store.Lock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer unlock()
+			if err := store.MoveCategory("home", "house"); err != nil {
+				t.Fatal(err)
+			}
+			tasks, err := store.ListTasks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"house/repairs:fix sink", "house:file taxes", "work:call bob"}
+			if bodies := taskBodies(tasks); !equalStrings(bodies, want) {
+				t.Errorf("after moving, ListTasks() = %v, want %v", bodies, want)
+			}
+			if err := store.DeleteCategory("house"); err != nil {
+				t.Fatal(err)
+			}
+			tasks, err = store.ListTasks()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = []string{"work:call bob"}
+			if bodies := taskBodies(tasks); !equalStrings(bodies, want) {
+				t.Errorf("after deleting, ListTasks() = %v, want %v", bodies, want)
+			}
+		})
+	}
+}
+
+func TestStoreMeta(t *testing.T) {
+	steps := []struct {
+		write  bool
+		append bool
+		data   string
+		want   string
+	}{
+		{want: ""},
+		// Nothing was written, so there's nothing to append to
+		{append: true, data: "lost", want: ""},
+		{write: true, data: "a\n", want: "a\n"},
+		{append: true, data: "b\n", want: "a\nb\n"},
+		{append: true, data: "c\n", want: "a\nb\nc\n"},
+		{write: true, data: "d\n", want: "d\n"},
+		// As the search index is dropped
+		{write: true, want: ""},
+		{append: true, data: "lost", want: ""},
+	}
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for i, step := range steps {
+				var err error
+				if step.write && step.data == "" {
+					err = store.WriteMeta("test", nil)
+				} else if step.write {
+					err = store.WriteMeta("test", []byte(step.data))
+				} else if step.append {
+					err = store.AppendMeta("test", []byte(step.data))
+				}
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				data, err := store.ReadMeta("test")
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if string(data) != step.want {
+					t.Errorf("step %d: ReadMeta() = %q, want %q", i, data, step.want)
+				}
+			}
+		})
+	}
+}
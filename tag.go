@@ -0,0 +1,228 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tags are written in task bodies with this in front, e.g. "call +home".
+const TAG_PREFIX = "+"
+
+// Punctuation that ends a sentence rather than a tag, e.g. "call +home."
+const TAG_TRAILING_PUNCTUATION = ".,;:!?)"
+
+type Tag struct {
+	Name string
+	// Tasks due with this tag
+	Tasks int
+	// Every task with this tag, whenever it's due
+	All int
+}
+
+func (tag Tag) String() string {
+	return fmt.Sprintf("%-20s %d tasks, %d in all", TAG_PREFIX+tag.Name, tag.Tasks, tag.All)
+}
+
+type Tags []Tag
+
+func (tags Tags) Len() int {
+	return len(tags)
+}
+
+func (tags Tags) Less(i, j int) bool {
+	return tags[i].Name < tags[j].Name
+}
+
+func (tags Tags) Swap(i, j int) {
+	tags[i], tags[j] = tags[j], tags[i]
+}
+
+// Checks a tag, returning it without its TAG_PREFIX if it has one.
+func CleanTag(tag string) (string, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), TAG_PREFIX)
+	if tag == "" || strings.ContainsAny(tag, " \t\n,|"+TAG_PREFIX) ||
+		strings.HasPrefix(tag, "-") {
+		return "", errors.New(fmt.Sprintf("Bad tag \"%s\"", tag))
+	}
+	return tag, nil
+}
+
+// Finds the tags written in a task body, e.g. "+home" in "call +home".
+func bodyTags(body string) []string {
+	var tags []string
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, TAG_PREFIX) {
+			continue
+		}
+		tag, err := CleanTag(strings.TrimRight(word, TAG_TRAILING_PUNCTUATION))
+		if err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Combines lists of tags, sorted and without duplicates.
+func mergeTags(lists ...[]string) []string {
+	seen := make(map[string]bool)
+	var merged []string
+	for _, tags := range lists {
+		for _, tag := range tags {
+			if !seen[tag] {
+				seen[tag] = true
+				merged = append(merged, tag)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// The tags not in the other list.
+func withoutTags(tags, other []string) []string {
+	var without []string
+	for _, tag := range tags {
+		if !hasTag(other, tag) {
+			without = append(without, tag)
+		}
+	}
+	return without
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, other := range tags {
+		if other == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Which tags to list, e.g. "+work|+home -waiting" is anything tagged work
+// or home that isn't tagged waiting.
+type TagFilter struct {
+	// Tasks need at least one tag from each of these.
+	AnyOf [][]string
+	// Tasks can't have any of these tags.
+	NoneOf []string
+}
+
+// Parses a filter of terms separated by spaces, each of which has to hold:
+// a tag such as "+work", any of several tags such as "+work|+home", or a
+// tag to leave out such as "-waiting". The "+" is optional.
+func ParseTagFilter(text string) (TagFilter, error) {
+	var filter TagFilter
+	for _, term := range strings.Fields(text) {
+		if strings.HasPrefix(term, "-") {
+			tag, err := CleanTag(strings.TrimPrefix(term, "-"))
+			if err != nil {
+				return filter, errors.New(fmt.Sprintf("Bad tag filter \"%s\": %v", text, err))
+			}
+			filter.NoneOf = append(filter.NoneOf, tag)
+			continue
+		}
+		var anyOf []string
+		for _, alternative := range strings.Split(term, "|") {
+			tag, err := CleanTag(alternative)
+			if err != nil {
+				return filter, errors.New(fmt.Sprintf("Bad tag filter \"%s\": %v", text, err))
+			}
+			anyOf = append(anyOf, tag)
+		}
+		filter.AnyOf = append(filter.AnyOf, anyOf)
+	}
+	return filter, nil
+}
+
+// A filter both filters have to match.
+func (filter TagFilter) And(other TagFilter) TagFilter {
+	return TagFilter{
+		AnyOf:  append(append([][]string(nil), filter.AnyOf...), other.AnyOf...),
+		NoneOf: append(append([]string(nil), filter.NoneOf...), other.NoneOf...),
+	}
+}
+
+// Determines if the filter lets everything through.
+func (filter TagFilter) Empty() bool {
+	return len(filter.AnyOf) == 0 && len(filter.NoneOf) == 0
+}
+
+// Determines if something with these tags is let through.
+func (filter TagFilter) Match(tags []string) bool {
+	for _, tag := range filter.NoneOf {
+		if hasTag(tags, tag) {
+			return false
+		}
+	}
+anyOf:
+	for _, anyOf := range filter.AnyOf {
+		for _, tag := range anyOf {
+			if hasTag(tags, tag) {
+				continue anyOf
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// The tasks the filter lets through.
+func (tasks_ Tasks) FilterTasksByTags(filter TagFilter) Tasks {
+	if filter.Empty() {
+		return tasks_
+	}
+	tasks := make(Tasks, 0)
+	for _, task := range tasks_ {
+		if filter.Match(task.Tags) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// The records the filter lets through.
+func (records_ Records) FilterRecordsByTags(filter TagFilter) Records {
+	if filter.Empty() {
+		return records_
+	}
+	var records Records
+	for _, record := range records_ {
+		if filter.Match(record.Tags) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Lists the tags on the manager's tasks along with how many of the tasks
+// are due, and how many there are in all.
+//
+// Corrupt tasks are not counted, see GetTasks for reporting them.
+func (manager *TaskManager) GetTags() (Tags, error) {
+	tasks, err := manager.GetTasks()
+	if err != nil && !IsCorrupt(err) {
+		return nil, err
+	}
+	counts := make(map[string]*Tag)
+	for _, task := range tasks {
+		for _, name := range task.Tags {
+			tag, exists := counts[name]
+			if !exists {
+				tag = &Tag{Name: name}
+				counts[name] = tag
+			}
+			tag.All++
+			if task.DueToday() {
+				tag.Tasks++
+			}
+		}
+	}
+	var tags Tags
+	for _, tag := range counts {
+		tags = append(tags, *tag)
+	}
+	sort.Sort(tags)
+	return tags, nil
+}
@@ -0,0 +1,91 @@
+package todo
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBodyTags(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{"buy milk", nil},
+		{"call +home about +work.", []string{"home", "work"}},
+		{"fix sink (for +repairs) + soon", []string{"repairs"}},
+		{"c++ and +-bad", nil},
+	}
+	for _, test := range tests {
+		if got := bodyTags(test.body); !equalStrings(got, test.want) {
+			t.Errorf("bodyTags(%q) = %v, want %v", test.body, got, test.want)
+		}
+	}
+}
+
+func TestTagFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		tags   []string
+		want   bool
+	}{
+		{"", nil, true},
+		{"+work", []string{"home", "work"}, true},
+		{"work", []string{"home"}, false},
+		{"+work|+home", []string{"home"}, true},
+		{"+work +urgent", []string{"work"}, false},
+		{"+work|+home -waiting", []string{"home", "waiting"}, false},
+		{"-waiting", nil, true},
+	}
+	for _, test := range tests {
+		filter, err := ParseTagFilter(test.filter)
+		if err != nil {
+			t.Errorf("ParseTagFilter(%q): %v", test.filter, err)
+			continue
+		}
+		if got := filter.Match(test.tags); got != test.want {
+			t.Errorf("%q matching %v = %v, want %v", test.filter, test.tags, got, test.want)
+		}
+	}
+	for _, text := range []string{"+", "work|", "-", "+work,home"} {
+		if _, err := ParseTagFilter(text); err == nil {
+			t.Errorf("ParseTagFilter(%q) should fail", text)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	taskManager, cmdManager := testManagers()
+	createTestTask(t, taskManager, "buy +milk")
+	if err := cmdManager.AddTag("+errand"); err != nil {
+		t.Fatal(err)
+	}
+	cmdManager.DueDate = testClock.Now().AddDate(0, 0, 3)
+	if _, err := cmdManager.CreateTask(taskManager, "post letter +home"); err != nil {
+		t.Fatal(err)
+	}
+	createTestTask(t, taskManager, "call +home")
+
+	tags, err := taskManager.GetTags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tag := range tags {
+		got = append(got, fmt.Sprintf("%s %d/%d", tag.Name, tag.Tasks, tag.All))
+	}
+	if want := []string{"errand 0/1", "home 1/2", "milk 1/1"}; !equalStrings(got, want) {
+		t.Errorf("GetTags() = %v, want %v", got, want)
+	}
+
+	filter, err := ParseTagFilter("+home -errand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := taskManager.GetTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := taskBodies(tasks.FilterTasksByTags(filter)), []string{":call +home"}; !equalStrings(got, want) {
+		t.Errorf("filtered %v, want %v", got, want)
+	}
+}
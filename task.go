@@ -1,9 +1,9 @@
 package todo
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -17,25 +17,77 @@ const EXPLICIT_TIME_FORMAT = "2006/01/02 MST"
 const RELATIVE_TIME_FORMAT = "Monday MST"
 
 type Task struct {
-	// The "body" content of the task.
+	// Identifies the task, no matter how it is changed.
+	ID string
+	// The "body" content of the task. A single line for tasks made since
+	// there were descriptions.
 	BodyContent string
 	// The first day when this task will appear. Not the actual due date.
+	// A calendar date, at midnight unless the task has a time of day, in
+	// Zone.
 	DueDate time.Time
+	// The IANA name of the zone the due date is in, e.g. "Europe/Berlin".
+	// Tasks from before there were zones only have the due date's offset.
+	Zone string `json:",omitempty"`
+	// Whether the task is due at the due date's time of day, rather than
+	// just on the day.
+	HasDueTime bool `json:",omitempty"`
+	// How long before the task is due to remind of it, see FireReminders.
+	Reminders []Reminder `json:",omitempty"`
 	// When to repeat this task when it is deleted.
 	// If it is null this task does not repeat.
-	//
-	// Can either be a time.Duration (as an int) or a more flexible date
-	// representation (e.g. Monday or a list of days with , separating).
-	Repeat *string
+	Repeat *Recurrence
+	// Whether the task repeats from its due date or from when it's done.
+	RepeatFrom RepeatAnchor `json:",omitempty"`
 	// How many days until this task is actually due.
 	OverdueDays int
-	fileName    string
+	// Longer notes on the task than its body, which is a single line. Kept
+	// as written, newlines and all.
+	Description string `json:",omitempty"`
+	// How important the task is, if it's been given a priority.
+	Priority Priority `json:",omitempty"`
+	// Sorted, without TAG_PREFIX. Includes the tags written in the body.
+	Tags []string `json:",omitempty"`
+	// Steps to the task, see CommandManager.CheckItem.
+	Checklist []ChecklistItem `json:",omitempty"`
+	// The IDs of the tasks that have to be done before this one can start.
+	BlockedBy []string `json:",omitempty"`
 	// The minimal index needed to specify this task
 	index string
-	// The full index
+	// The full index, derived from the ID
 	fullIndex string
 	// optional category
 	category *string
+	// What the time is, set by the TaskManager the task came from
+	clock Clock
+	// Whether any task in BlockedBy is still to do, set by
+	// TaskManager.GetTasks
+	blocked bool
+}
+
+func (task Task) now() time.Time {
+	return orSystemClock(task.clock).Now()
+}
+
+// Puts the due date back in the task's zone once it's read, as JSON only
+// keeps its offset, which changes with daylight saving.
+func (task *Task) UnmarshalJSON(data []byte) error {
+	type plainTask Task
+	if err := json.Unmarshal(data, (*plainTask)(task)); err != nil {
+		return err
+	}
+	if task.Zone != "" {
+		if location, err := time.LoadLocation(task.Zone); err == nil {
+			task.DueDate = task.DueDate.In(location)
+		}
+	}
+	return nil
+}
+
+// Sets the due date, along with the zone it's in.
+func (task *Task) setDueDate(dueDate time.Time) {
+	task.DueDate = dueDate
+	task.Zone = zoneName(dueDate.Location())
 }
 
 func (task Task) GetFullIndex() string {
@@ -55,23 +107,16 @@ func (task Task) String() string {
 		categoryName = "(" + *task.category + ")"
 	}
 	daysLeft := " "
-	dueDate := time.Now().AddDate(0, 0, -task.OverdueDays)
-	if task.DueBefore(dueDate) {
-		passedDueDate := task.DueDate.AddDate(0, 0, task.OverdueDays)
-		/*passedDueDate = passedDueDate.Truncate(DAY_HOURS)*/
-		overdueDays := int(math.Floor(time.Now().Sub(passedDueDate).Hours() / 24))
-		if task.DueBefore(time.Now().Truncate(DAY_HOURS)) && overdueDays > /*=*/ 0 {
-			if overdueDays == 1 || overdueDays == 0 {
-				daysLeft = fmt.Sprintf(" (%d day overdue)", 1)
-			} else {
-				daysLeft = fmt.Sprintf(" (%d days overdue)", overdueDays)
-			}
+	// Counted in calendar days, so daylight saving doesn't make a day
+	// more or less than a day.
+	days := daysBetween(task.now(), task.DueDate.AddDate(0, 0, task.OverdueDays))
+	if days < 0 {
+		if days == -1 {
+			daysLeft = fmt.Sprintf(" (%d day overdue)", 1)
 		} else {
-			daysLeft = " (due today)"
+			daysLeft = fmt.Sprintf(" (%d days overdue)", -days)
 		}
 	} else if task.OverdueDays > 0 {
-		finalDueDate := task.DueDate.AddDate(0, 0, task.OverdueDays)
-		days := int(math.Ceil(finalDueDate.Sub(time.Now()).Hours() / 24))
 		if days == 0 {
 			daysLeft = " (due today)"
 		} else if days == 1 {
@@ -81,21 +126,69 @@ func (task Task) String() string {
 		}
 	}
 	trimmed_content := strings.TrimSuffix(task.BodyContent, "\n")
+	// Tags that aren't written in the body still need showing
+	for _, tag := range withoutTags(task.Tags, bodyTags(task.BodyContent)) {
+		trimmed_content += " " + TAG_PREFIX + tag
+	}
 	preamble := task.index + ":"
+	if task.Priority != PRIORITY_NONE {
+		preamble += " (" + task.Priority.String() + ")"
+	}
 	return HardWrapString(trimmed_content,
-		60,
+		bodyLength(),
 		preamble,
 		10,
-		fmt.Sprintf("%-15s%s", categoryName, daysLeft),
+		padRight(categoryName, 15)+daysLeft+task.descriptionMarker()+task.checklistMarker()+
+			task.dueTimeMarker()+task.repeatMarker()+task.blockedMarker(),
 		" ")
 }
 
+// When the task is actually due, after its overdue days: at its due time,
+// or the start of the day if it doesn't have one.
+func (task Task) DueAt() time.Time {
+	due := task.DueDate.AddDate(0, 0, task.OverdueDays)
+	if task.HasDueTime {
+		return due
+	}
+	return startOfDay(due)
+}
+
+// Shows the time of day a task is due, if it has one, e.g. " at 14:00".
+func (task Task) dueTimeMarker() string {
+	if !task.HasDueTime {
+		return ""
+	}
+	return " at " + task.DueDate.Format("15:04")
+}
+
+// Marks repeating tasks with what they repeat from, e.g. " ↻ done".
+func (task Task) repeatMarker() string {
+	if task.Repeat == nil {
+		return ""
+	}
+	return " ↻ " + task.RepeatFrom.String()
+}
+
+// The day a repeating task is next due, if it's completed on the given day.
+func (task Task) NextDueDate(completed time.Time) (time.Time, error) {
+	if task.RepeatFrom == FROM_COMPLETION {
+		next, err := task.Repeat.Next(completed.In(task.DueDate.Location()))
+		if err != nil || !task.HasDueTime {
+			return next, err
+		}
+		// Keep to the time of day the task is due at
+		return time.Date(next.Year(), next.Month(), next.Day(), task.DueDate.Hour(),
+			task.DueDate.Minute(), task.DueDate.Second(), 0, next.Location()), nil
+	}
+	return task.Repeat.Next(task.DueDate)
+}
+
 /// Creates a new task, without saving it.
-func NewTask(text string, dueDate time.Time, repeat *string, overdueDays int) (Task, error) {
+func NewTask(text string, dueDate time.Time, repeat *Recurrence, overdueDays int) (Task, error) {
 	if !utf8.ValidString(text) {
-		panic(fmt.Sprintf("Invalid UTF-8 string: %v", text))
+		return Task{}, errors.New(fmt.Sprintf("Invalid UTF-8 string: %v", text))
 	}
-	text = strings.TrimSuffix(text, "\n")
+	text, description := SplitTaskText(text)
 	if text == "" {
 		msg := "Cannot make a task with an empty string"
 		LogError(msg)
@@ -103,7 +196,9 @@ func NewTask(text string, dueDate time.Time, repeat *string, overdueDays int) (T
 	}
 	var task Task
 	task.BodyContent = text
-	task.DueDate = dueDate
+	task.Description = description
+	task.Tags = mergeTags(bodyTags(text))
+	task.setDueDate(dueDate)
 	task.Repeat = repeat
 	task.OverdueDays = overdueDays
 	return task, nil
@@ -112,32 +207,37 @@ func NewTask(text string, dueDate time.Time, repeat *string, overdueDays int) (T
 // Format just the task body
 func (task *Task) FormatTask() string {
 	passedDueDate := task.DueDate.AddDate(0, 0, task.OverdueDays)
-	overdueDays := int(math.Floor(time.Now().Sub(passedDueDate).Hours() / 24))
-	if overdueDays > 0 {
-		//if task.DueBefore(time.Now().AddDate(0, 0, -task.OverdueDays)) {
-		return RED + task.String() + RESET
-	} else if task.DueAfter(time.Now().AddDate(0, 0, 6)) {
-		return GREY + task.String() + RESET
+	now := task.now()
+	theme := currentDisplay().Theme
+	if daysBetween(passedDueDate, now) > 0 || task.HasDueTime && now.After(passedDueDate) {
+		return colorize(theme.Overdue, task.String())
+	} else if task.DueAfter(now.AddDate(0, 0, 6)) || task.blocked {
+		return colorize(theme.Greyed, task.String())
+	} else if task.Priority == PRIORITY_A {
+		return colorize(theme.Important, task.String())
+	} else if task.DueToday() {
+		return colorize(theme.DueToday, task.String())
 	}
-	return RESET + task.String()
+	return colorize(theme.Future, task.String())
 }
 
 /// Determines if a task is due exactly on this day. Not before, not after.
 func (task *Task) DueOn(date time.Time) bool {
-	return !(task.DueDate.Before(date) || task.DueBefore(date))
+	return daysBetween(task.DueDate, date) == 0
 }
 
 // Determines if a task is due today (or any days before today)
 //
 // NOTE This is NOT a special case of Task.DueOn.
 func (task *Task) DueToday() bool {
-	return is_same_day(task.DueDate, time.Now()) ||
-		task.DueDate.Before(time.Now())
+	now := task.now()
+	return is_same_day(task.DueDate, now) ||
+		task.DueDate.Before(now)
 }
 
-/// Determines if a task is due before today.
+/// Determines if a task is due on a day before the date.
 func (task *Task) DueBefore(date time.Time) bool {
-	return task.DueDate.Before(date.Truncate(DAY_HOURS))
+	return daysBetween(task.DueDate, date) > 0
 }
 
 func (task *Task) DueAfter(after time.Time) bool {
@@ -149,3 +249,111 @@ func is_same_day(a time.Time, b time.Time) bool {
 		a.Month() == b.Month() &&
 		a.Year() == b.Year()
 }
+
+// Changes to make to a task when editing it. Fields left nil are kept.
+type TaskChanges struct {
+	BodyContent *string
+	DueDate     *time.Time
+	Reminders   *[]Reminder
+	// Parsed with ParseRecurrence. An empty string stops the task from
+	// repeating.
+	Repeat      *string
+	RepeatFrom  *RepeatAnchor
+	OverdueDays *int
+	Priority    *Priority
+	// Replaces the tags, besides those written in the body.
+	Tags *[]string
+	// Replaces the description, "" removing it.
+	Description *string
+	// Added to the end of the checklist.
+	AddItems *[]string
+	// Replaces the IDs of the tasks this one waits on.
+	BlockedBy *[]string
+	// Whether DueDate has a time of day. Only used along with DueDate.
+	HasDueTime bool
+	// An empty string moves the task out of its category.
+	Category *string
+}
+
+// Determines if there are any changes at all.
+func (changes TaskChanges) Empty() bool {
+	return changes == TaskChanges{}
+}
+
+// Makes the changes to a copy of the task.
+func (changes TaskChanges) Apply(task Task) (Task, error) {
+	if changes.BodyContent != nil {
+		edited, err := NewTask(*changes.BodyContent, task.DueDate, task.Repeat, task.OverdueDays)
+		if err != nil {
+			return task, err
+		}
+		// Tags that were only in the old body go with it
+		task.Tags = mergeTags(withoutTags(task.Tags, bodyTags(task.BodyContent)), edited.Tags)
+		task.BodyContent = edited.BodyContent
+		// A body of several lines brings a new description with it
+		if edited.Description != "" {
+			task.Description = edited.Description
+		}
+	}
+	if changes.Description != nil {
+		task.Description = *changes.Description
+	}
+	if changes.Tags != nil {
+		task.Tags = mergeTags(*changes.Tags, bodyTags(task.BodyContent))
+	}
+	if changes.AddItems != nil {
+		items, err := NewChecklist(*changes.AddItems)
+		if err != nil {
+			return task, err
+		}
+		task.Checklist = append(append([]ChecklistItem(nil), task.Checklist...), items...)
+	}
+	if changes.BlockedBy != nil {
+		task.BlockedBy = append([]string(nil), *changes.BlockedBy...)
+		if len(task.BlockedBy) == 0 {
+			task.blocked = false
+		}
+	}
+	if changes.DueDate != nil {
+		task.setDueDate(*changes.DueDate)
+		task.HasDueTime = changes.HasDueTime
+	}
+	if changes.Reminders != nil {
+		task.Reminders = append([]Reminder(nil), *changes.Reminders...)
+	}
+	if changes.Repeat != nil {
+		if *changes.Repeat == "" {
+			task.Repeat = nil
+		} else {
+			repeat, err := ParseRecurrence(*changes.Repeat)
+			if err != nil {
+				return task, err
+			}
+			task.Repeat = repeat
+		}
+	}
+	if changes.RepeatFrom != nil {
+		task.RepeatFrom = *changes.RepeatFrom
+	}
+	if changes.OverdueDays != nil {
+		if *changes.OverdueDays < 0 {
+			return task, errors.New("Overdue days can't be negative")
+		}
+		task.OverdueDays = *changes.OverdueDays
+	}
+	if changes.Priority != nil {
+		task.Priority = *changes.Priority
+	}
+	if changes.Category != nil {
+		category, err := CleanCategory(*changes.Category)
+		if err != nil {
+			return task, err
+		}
+		if category == "" {
+			task.category = nil
+		} else {
+			task.category = &category
+		}
+	}
+	return task, nil
+}
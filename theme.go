@@ -0,0 +1,121 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// An SGR escape sequence to colour text with, e.g. "\x1b[31m" for red, or
+// "" to leave it be.
+type Color string
+
+// SGR codes for the colours and attributes ParseColor knows by name.
+var COLOR_CODES = map[string]string{
+	"black":     "30",
+	"red":       "31",
+	"green":     "32",
+	"yellow":    "33",
+	"blue":      "34",
+	"magenta":   "35",
+	"cyan":      "36",
+	"white":     "37",
+	"grey":      "90",
+	"gray":      "90",
+	"bold":      "1",
+	"dim":       "2",
+	"italic":    "3",
+	"underline": "4",
+	"reverse":   "7",
+}
+
+// Reads a colour from names separated by spaces, e.g. "red", "bold
+// bright-blue" or "black on-yellow", or from SGR codes, e.g. "38;5;208".
+// "bright-" makes a colour brighter and "on-" makes it the background.
+// "default", or nothing at all, leaves text be.
+func ParseColor(text string) (Color, error) {
+	var codes []string
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if word == "default" {
+			continue
+		}
+		code, err := colorCode(word)
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("Bad colour \"%s\": %v", text, err))
+		}
+		codes = append(codes, code)
+	}
+	if len(codes) == 0 {
+		return "", nil
+	}
+	return Color("\x1b[" + strings.Join(codes, ";") + "m"), nil
+}
+
+func colorCode(word string) (string, error) {
+	if strings.Trim(word, "0123456789;") == "" {
+		return word, nil
+	}
+	name := word
+	background := strings.HasPrefix(name, "on-")
+	name = strings.TrimPrefix(name, "on-")
+	bright := strings.HasPrefix(name, "bright-")
+	name = strings.TrimPrefix(name, "bright-")
+	code, exists := COLOR_CODES[name]
+	if !exists {
+		return "", errors.New(fmt.Sprintf("no colour called \"%s\"", word))
+	}
+	number, _ := strconv.Atoi(code)
+	if background || bright {
+		if number < 30 || number > 37 {
+			return "", errors.New(fmt.Sprintf("\"%s\" isn't a colour that can be bright or a background", name))
+		}
+		if bright {
+			number += 60
+		}
+		if background {
+			number += 10
+		}
+	}
+	return strconv.Itoa(number), nil
+}
+
+func (color *Color) UnmarshalText(text []byte) error {
+	parsed, err := ParseColor(string(text))
+	if err != nil {
+		return err
+	}
+	*color = parsed
+	return nil
+}
+
+// The colours output is shown in. In the config file each is anything
+// ParseColor reads, e.g. {"Overdue": "bold red", "DueToday": "green"}.
+type Theme struct {
+	// Tasks past when they're due, and records of tasks done late.
+	Overdue Color
+	// Tasks due today.
+	DueToday Color
+	// Tasks due later in the week.
+	Future Color
+	// Tasks due more than a week from now, blocked tasks, and things
+	// that matter less, e.g. checklist items that are done.
+	Greyed Color
+	// Tasks of priority A, unless they're overdue or greyed.
+	Important Color
+	// Words search matched.
+	Highlight Color
+	// Messages saying a command worked, and saying it didn't.
+	Success Color
+	Error   Color
+}
+
+// The colours output is shown in unless the config file says otherwise.
+var DEFAULT_THEME = Theme{
+	Overdue:   RED,
+	Greyed:    GREY,
+	Important: YELLOW,
+	Highlight: HIGHLIGHT,
+	Success:   GREEN,
+	Error:     RED,
+}
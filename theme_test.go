@@ -0,0 +1,50 @@
+package todo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		text string
+		want Color
+	}{
+		{"red", "\x1b[31m"},
+		{"bold bright-blue", "\x1b[1;94m"},
+		{"black on-yellow", "\x1b[30;43m"},
+		{"38;5;208", "\x1b[38;5;208m"},
+		{"default", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		got, err := ParseColor(test.text)
+		if err != nil {
+			t.Errorf("ParseColor(%q) failed: %v", test.text, err)
+		} else if got != test.want {
+			t.Errorf("ParseColor(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+	for _, text := range []string{"purple", "bright-bold", "on-"} {
+		if got, err := ParseColor(text); err == nil {
+			t.Errorf("ParseColor(%q) = %q, want an error", text, got)
+		}
+	}
+}
+
+func TestThemeJSON(t *testing.T) {
+	config := Config{Theme: DEFAULT_THEME}
+	err := json.Unmarshal([]byte(`{"Theme": {"Overdue": "bold red", "DueToday": "green"}}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DEFAULT_THEME
+	want.Overdue = "\x1b[1;31m"
+	want.DueToday = GREEN
+	if config.Theme != want {
+		t.Errorf("Theme = %+v, want %+v", config.Theme, want)
+	}
+	if err := json.Unmarshal([]byte(`{"Theme": {"Greyed": "purple"}}`), &config); err == nil {
+		t.Error("Unmarshal of a bad colour didn't fail")
+	}
+}
@@ -2,16 +2,17 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"git.sr.ht/~sircmpwn/getopt"
 	"git.sr.ht/~timidger/todo"
 	"github.com/mattn/go-isatty"
+	"golang.org/x/term"
 	"io/ioutil"
 	"os"
-	"path"
+	"os/exec"
 	"strconv"
 	"strings"
-	"time"
 )
 
 const HELP_MESSAGE = "Usage of todo:\n" +
@@ -26,35 +27,135 @@ const HELP_MESSAGE = "Usage of todo:\n" +
 	"  -s <index>      Skip a task, deleting it but not logging it. This is only valid for repeat tasks.\n" +
 	"                  Note that the task will be regenerated, if that's not what you want see -D\n" +
 	"  -t <date>       Delay the task until the date\n" +
-	"                  Date uses YYYY/MM/DD. Relative days such as \"Monday\" or \"Tomorrow\" are also supported\n" +
+	"                  Date uses YYYY/MM/DD. Relative dates such as \"Monday\", \"next friday\", \"in 3 days\",\n" +
+	"                  \"end of month\" and \"jan 5\" are also supported, as are times such as \"tomorrow 3pm\"\n" +
+	"                  With a time the task is due then rather than some time that day\n" +
 	"                  If coupled with -A then it will show logs of any events on or after this date\n" +
-	"  -r <number>     Repeat this task after a number of days. Based on the due date, not the day it was deleted\n" +
-	"                  Default 0, Must be either a positive number or days separated by \",\".\n" +
+	"  -r <repeat>     Repeat this task. Based on the due date, not the day it was deleted\n" +
+	"                  Either a number of days, an RRULE such as \"FREQ=WEEKLY;BYDAY=MO,FR\" or a description\n" +
+	"                  such as \"every 2 weeks on Tue,Thu\", \"monthly on the 15th\", \"last Friday of the month\",\n" +
+	"                  \"every weekday\" or \"yearly\". With -E, 0 stops the task from repeating\n" +
+	"  -R <due|done>   What a repeating task's next occurrence counts from, its due date (the default) or the\n" +
+	"                  day it's done, e.g. \"todo -r 3 -R done water the plants\". Listings show it after the task\n" +
+	"  -b <before>     Remind of the task this long before it's due, e.g. \"15m\", \"2h\" or \"1d\", see -N\n" +
+	"                  Can be given more than once. With -E, replaces the task's reminders\n" +
+	"  -P <priority>   How important this task is, A (most) to D (least), or 1 to 4. Tasks due the same day\n" +
+	"                  are listed most important first, and A tasks are highlighted. With -E, 0 clears it\n" +
+	"  -p <priority>   Only list tasks at least this important with -l or -a, e.g. \"todo -p B -l\"\n" +
+	"  -T <tag>        Tag this task, as well as any \"+tag\" written in it, e.g. \"todo -T errand buy +milk\"\n" +
+	"                  Can be given more than once. With -E, replaces the tags not written in the body\n" +
+	"  -F <filter>     Only list, with -l, -a or -A, what has the tags. Tags separated by spaces are all needed,\n" +
+	"                  \"|\" lists alternatives and \"-\" leaves a tag out, e.g. \"todo -F '+work|+home -waiting' -l\"\n" +
+	"  -q <query>      Only list, with -l, -a or -A, what matches the query, e.g.\n" +
+	"                  \"todo -q 'overdue category:work repeat:weekly' -a\" or \"todo -q 'completed:march not notes=\"\"' -A\"\n" +
+	"                  Terms are field:value, using body, category, tag, due, overdue, repeat, priority,\n" +
+	"                  completed and notes, and can be compared with =, !=, <, <=, > and >=, e.g. \"overdue>2\"\n" +
+	"                  Terms all have to match unless joined by \"or\", \"not\" turns a term around, and\n" +
+	"                  parentheses group terms. A word on its own is looked for in the task\n" +
+	"  -i <item>       Add an item to this task's checklist, e.g. \"todo -i 'buy paint' -i 'paint the wall' decorate\"\n" +
+	"                  Can be given more than once. With -E, adds to the task's checklist\n" +
+	"  -k <index>.<n>  Check off the nth item in a task's checklist, logging it in the audit log. Checking off the\n" +
+	"                  last item completes the task. Can be paired with -e\n" +
+	"  -m <text>       Describe this task in more detail than its body, e.g. \"todo -m 'the blue one' paint the wall\"\n" +
+	"                  Newlines are kept. Text given on stdin can do the same: its first line is the body and\n" +
+	"                  the rest the description. -a shows descriptions, -l marks tasks that have one with ✎\n" +
+	"                  With -E, replaces the description, \"\" removes it\n" +
+	"  -B <index>      This task can't start until the task with this index is done, e.g. \"todo -B 3f paint the wall\"\n" +
+	"                  Until then -l leaves it out and -a greys it. Can be given more than once. With -E, replaces\n" +
+	"                  what the task waits on, \"\" for nothing. Tasks can't end up waiting on each other\n" +
+	"  -V              Print the tasks that wait on others, and what they wait on, as a Graphviz graph, e.g.\n" +
+	"                  \"todo -V | dot -Tsvg > todo.svg\". Blocked tasks are dashed\n" +
 	"  -n <number>     Days until this task is actually due. Think of this as \"How many days I want to work on this task\"\n" +
 	"                  Default 0, must be positive\n" +
 	"  -e <notes>      Annotate task completion so it shows up in the audit log later\n" +
 	"                  Can be paired with -d or -s\n" +
-	"  -c <category>   Specify a category\n" +
-	"  -C <category>   Create a new category\n" +
+	"  -E <index>      Edit a task in place, changing whatever -t, -r, -R, -b, -P, -T, -i, -m, -B, -n and -M say to and using any text\n" +
+	"                  given as the new body. With none of those the body is opened in $EDITOR, along with the\n" +
+	"                  description after a blank line\n" +
+	"  -M <category>   Move the tasks whose indices follow to this category, e.g. \"todo -M work 3f a1\"\n" +
+	"                  With -E, move the task being edited instead. \"\" is no category\n" +
+	"  -c <category>   Specify a category. Categories nest by path, e.g. \"-c work/clientA\"\n" +
+	"                  Listing a category includes the categories nested in it\n" +
+	"  -C <category>   Create a new category, along with any it's nested in\n" +
 	"  -L              List all the categories\n" +
+	"  -K <action>     Manage the categories that follow:\n" +
+	"                  \"todo -K rename <from> <to>\" renames a category, moving its tasks, audit log and nested\n" +
+	"                  categories with it. \"todo -K merge <from> <into>\" moves everything in a category into\n" +
+	"                  another one, then removes it. \"todo -K archive <category>\" moves a category into \".archive\",\n" +
+	"                  hiding it unless \"-c .archive\" is given. \"todo -K delete <category>\" deletes a category\n" +
+	"                  and its audit log, refusing if it has tasks unless -f is given\n" +
+	"  -f              Go ahead with -K delete even if it throws away tasks, or with -U purge now\n" +
+	"  -N              Print the reminders that have come due since it last ran, each one only once. Run it from\n" +
+	"                  cron or similar. If ~/.config/todo/config.json has a \"RemindCommand\", e.g.\n" +
+	"                  {\"RemindCommand\": \"notify-send \\\"$1\\\" \\\"due $2\\\"\"}, it's run through sh for each\n" +
+	"                  reminder instead, with the task as $1 and when it's due as $2\n" +
+	"  -U              Show what happens to overdue tasks the next time todo runs, or with -f do it now.\n" +
+	"                  Tasks more than 3 days overdue are dropped, removing them but logging them in the audit\n" +
+	"                  log. \"Purge\" in the config file changes that by category, nested categories included, e.g.\n" +
+	"                  {\"Purge\": {\"\": {\"Action\": \"delete\", \"Days\": 7}, \"work\": {\"Action\": \"archive\"},\n" +
+	"                  \"home\": {\"Action\": \"drop\", \"Reason\": \"ran out of time\"}}}. Actions are never, archive\n" +
+	"                  (into .archive), drop and delete, which leaves no trace of the task\n" +
+	"  -w <words>      Find the tasks, then audit log entries, with all the words in them or their notes or tags,\n" +
+	"                  best matches first, e.g. \"todo -w paint wall\". Words match anywhere in a word, or close\n" +
+	"                  enough allowing for typos\n" +
+	"  -I              Build the index of the audit log that -w searches again, if it's out of date\n" +
+	"  -G              List all the tags, with how many tasks are due and how many there are in all\n" +
 	"  -A              Show audit logs. Can be controlled with -t and -c\n" +
-	"  -S <directory>  Specify a custom todo directory (default is ~/.todo). Primarily used for testing\n"
+	"  -S <directory>  Specify a custom todo directory (default is $TODO_STORAGE or ~/.todo). Primarily used for testing\n" +
+	"                  A path ending in .db is used as a SQLite database instead of a directory\n" +
+	"  -o <store>      Copy every task, category and audit log from the storage, -S or the usual one, into another,\n" +
+	"                  new, store, e.g. \"todo -S ~/.todo -o ~/.todo.db\"\n" +
+	"\n" +
+	"  Set TODO_NOW to a date, e.g. TODO_NOW=2026-03-01 or TODO_NOW=tomorrow, to act as if it's that day\n" +
+	"  Output fits the terminal, or $COLUMNS. It's only coloured on a terminal, and never if NO_COLOR is set\n" +
+	"  \"Theme\" in the config file changes the colours of Overdue, DueToday, Future, Greyed and Important\n" +
+	"  tasks, search Highlight, and Success and Error messages, e.g. {\"Theme\": {\"Overdue\": \"bold red\",\n" +
+	"  \"DueToday\": \"green\", \"Greyed\": \"dim\"}}. Colours are red, bright-red, on-red for the background and\n" +
+	"  so on, grey, bold, dim, italic, underline, reverse, default, or SGR codes such as \"38;5;208\"\n"
 
 func main() {
-	opts, others, err := getopt.Getopts(os.Args, "ALhalt:d:x:D:S:C:c:r:n:s:e:")
+	setUpDisplay()
+	opts, others, err := getopt.Getopts(os.Args, "ALGhalt:d:x:D:S:C:c:r:R:n:s:e:E:M:b:P:p:T:F:q:i:k:B:m:o:K:fNUw:IV")
 	if err != nil {
 		fmt.Printf("%s", HELP_MESSAGE)
 		return
 	}
+	if runCommand(opts, os.Args[others:]) {
+		return
+	}
 	var task *todo.Task
-	var taskManager todo.TaskManager
-	taskManager.StorageDirectory = path.Join(os.Getenv("HOME"), ".todo/")
+	taskManager := openTaskManager(todo.DefaultStorage())
 
 	var cmdManager todo.CommandManager
-	cmdManager.DueDate = time.Now()
+	cmdManager.Clock = clock()
+	cmdManager.DueDate = cmdManager.Clock.Now()
 	cmdManager.Listing = todo.LISTING_DAY
 
-	instantDelete := execute_flag_commands(&taskManager, &cmdManager, opts)
+	var pendingEdit edit
+	instantDelete := execute_flag_commands(&taskManager, &cmdManager, opts, &pendingEdit)
+
+	if pendingEdit.index != "" {
+		input := strings.Join(os.Args[others:], " ")
+		if input != "" {
+			pendingEdit.changes.BodyContent = &input
+		}
+		edited, err := runEdit(&taskManager, &cmdManager, pendingEdit)
+		if err != nil {
+			todo.LogError(err.Error())
+			os.Exit(1)
+		}
+		todo.LogSuccess(edited.String())
+	} else if pendingEdit.changes.Category != nil {
+		moved, err := cmdManager.MoveTasks(&taskManager, os.Args[others:],
+			*pendingEdit.changes.Category)
+		if err != nil {
+			todo.LogError(err.Error())
+			os.Exit(1)
+		}
+		for _, task := range moved {
+			todo.LogSuccess(task.String())
+		}
+	}
 
 	if len(opts) == 0 || !cmdManager.SkipTaskCreationPrompt {
 		input := strings.Join(os.Args[others:], " ")
@@ -70,7 +171,7 @@ func main() {
 		}
 
 		if instantDelete {
-			todo.ClearCache()
+			cmdManager.ClearCache()
 			taskDeleted, err := cmdManager.DeleteTask(&taskManager, task.GetFullIndex(), false)
 			if err != nil {
 				todo.LogError(err.Error())
@@ -83,33 +184,366 @@ func main() {
 	// XXX At this point we can mess with the state as much as we want
 	// We want all to remove all out of date tasks at this point, so we
 	// the default state.
-	cmdManager = todo.CommandManager{}
-	cmdManager.DueDate = time.Now()
+	config := loadConfig()
+	purger, purgeManager, tasks := overdueTasks(todo.DefaultStorage())
+	// Pretending it's another day shouldn't throw away tasks for real
+	if _, pretending := purger.Clock.(todo.FixedClock); pretending {
+		return
+	}
+	if err := purger.RemoveOverdueTasks(tasks, &purgeManager, config.Purge); err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+}
+
+// The tasks in the storage that purging looks at, along with the managers to
+// purge them with.
+func overdueTasks(storage string) (*todo.CommandManager, todo.TaskManager, todo.Tasks) {
+	cmdManager := &todo.CommandManager{}
+	cmdManager.Clock = clock()
+	cmdManager.DueDate = cmdManager.Clock.Now()
 	cmdManager.Listing = todo.LISTING_DAY
 
-	taskManager = todo.TaskManager{}
-	taskManager.StorageDirectory = path.Join(os.Getenv("HOME"), ".todo/")
+	taskManager := openTaskManager(storage)
 
 	tasks, err := cmdManager.GetTasks(&taskManager)
 	if err != nil {
 		todo.LogError(err.Error())
 		os.Exit(1)
 	}
-	cmdManager.RemoveOverdueTasks(tasks, &taskManager)
+	return cmdManager, taskManager, tasks
+}
+
+func loadConfig() todo.Config {
+	config, err := todo.LoadConfig(todo.DefaultConfigPath())
+	if err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+	return config
+}
+
+// Fits output to the terminal's width, or $COLUMNS, in the config file's
+// colours, unless NO_COLOR is set or output isn't a terminal.
+func setUpDisplay() {
+	width, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	if columns, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && columns > 0 {
+		width = columns
+	}
+	display := todo.Display{
+		Width:     width,
+		Colors:    os.Getenv("NO_COLOR") == "" && isatty.IsTerminal(os.Stdout.Fd()),
+		LogColors: os.Getenv("NO_COLOR") == "" && isatty.IsTerminal(os.Stderr.Fd()),
+		Theme:     todo.DEFAULT_THEME,
+	}
+	// A bad config file is reported like anything else
+	todo.SetDisplay(display)
+	display.Theme = loadConfig().Theme
+	todo.SetDisplay(display)
+}
+
+func openTaskManager(location string) todo.TaskManager {
+	store, err := todo.OpenStore(location)
+	if err != nil {
+		todo.LogError(fmt.Sprintf("Could not open \"%s\": %v", location, err))
+		os.Exit(1)
+	}
+	var taskManager todo.TaskManager
+	taskManager.StorageDirectory = location
+	taskManager.Store = store
+	taskManager.Clock = clock()
+	return taskManager
+}
+
+// The system clock, unless $TODO_NOW says to pretend it's another time,
+// e.g. TODO_NOW=tomorrow to see tomorrow's list.
+func clock() todo.Clock {
+	clock, err := todo.EnvClock()
+	if err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+	return clock
+}
+
+// Runs a flag that's a command of its own, e.g. -o, rather than something
+// to do with the tasks. Returns whether there was one.
+func runCommand(opts []getopt.Option, args []string) bool {
+	storage := todo.DefaultStorage()
+	force := false
+	reindex := false
+	// What -w searches for, nil without one
+	var words []string
+	for _, opt := range opts {
+		switch opt.Option {
+		case 'S':
+			storage = opt.Value
+		case 'f':
+			force = true
+		case 'I':
+			reindex = true
+		case 'w':
+			words = append([]string{opt.Value}, args...)
+		}
+	}
+	for _, opt := range opts {
+		switch opt.Option {
+		case 'o':
+			migrate(storage, opt.Value, args)
+		case 'K':
+			manageCategory(storage, opt.Value, args, force)
+		case 'N':
+			remind(storage, args)
+		case 'U':
+			purge(storage, args, force)
+		case 'w', 'I':
+			if words == nil && len(args) != 0 {
+				fmt.Printf("%s", HELP_MESSAGE)
+				os.Exit(1)
+			}
+			search(storage, words, reindex)
+		case 'V':
+			graph(storage, args)
+		default:
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// todo [-S <from>] -o <to>
+func migrate(from, to string, args []string) {
+	if len(args) != 0 {
+		fmt.Printf("%s", HELP_MESSAGE)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(from); err != nil {
+		todo.LogError(fmt.Sprintf("Could not read \"%s\": %v", from, err))
+		os.Exit(1)
+	}
+	fromManager := openTaskManager(from)
+	toManager := openTaskManager(to)
+	if err := todo.MigrateStore(fromManager.Store, toManager.Store); err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+	todo.LogSuccess(fmt.Sprintf("Migrated \"%s\" to \"%s\"", from, to))
+}
+
+// todo [-f] -K <rename|merge|archive|delete> <category>...
+func manageCategory(storage, action string, args []string, force bool) {
+	taskManager := openTaskManager(storage)
+	var err error
+	var done string
+	switch {
+	case len(args) == 2 && action == "rename":
+		err = taskManager.RenameCategory(args[0], args[1])
+		done = fmt.Sprintf("Renamed \"%s\" to \"%s\"", args[0], args[1])
+	case len(args) == 2 && action == "merge":
+		err = taskManager.MergeCategory(args[0], args[1])
+		done = fmt.Sprintf("Merged \"%s\" into \"%s\"", args[0], args[1])
+	case len(args) == 1 && action == "archive":
+		err = taskManager.ArchiveCategory(args[0])
+		done = fmt.Sprintf("Archived \"%s\"", args[0])
+	case len(args) == 1 && action == "delete":
+		err = taskManager.DeleteCategory(args[0], force)
+		done = fmt.Sprintf("Deleted \"%s\"", args[0])
+	default:
+		fmt.Printf("%s", HELP_MESSAGE)
+		os.Exit(1)
+	}
+	if errors.Is(err, todo.ErrCategoryNotEmpty) {
+		todo.LogError(err.Error() + ", use -f to delete them too")
+		os.Exit(1)
+	} else if err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+	todo.LogSuccess(done)
+}
+
+// todo -N
+func remind(storage string, args []string) {
+	if len(args) != 0 {
+		fmt.Printf("%s", HELP_MESSAGE)
+		os.Exit(1)
+	}
+	config := loadConfig()
+	taskManager := openTaskManager(storage)
+	fired, err := taskManager.FireReminders()
+	if err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+	for _, reminder := range fired {
+		if config.RemindCommand == "" {
+			fmt.Println(reminder.String())
+			continue
+		}
+		body := strings.TrimSuffix(reminder.Task.BodyContent, "\n")
+		due := reminder.Task.DueAt().Format("Monday 2006/01/02 15:04")
+		cmd := exec.Command("sh", "-c", config.RemindCommand, "sh", body, due)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			todo.LogError(fmt.Sprintf("%s failed: %v", config.RemindCommand, err))
+		}
+	}
+}
+
+// todo [-I] -w <words>, or todo -I
+func search(storage string, words []string, reindex bool) {
+	taskManager := openTaskManager(storage)
+	if reindex {
+		if err := taskManager.ReindexSearch(); err != nil {
+			todo.LogError(err.Error())
+			os.Exit(1)
+		}
+		if words == nil {
+			todo.LogSuccess("Rebuilt the search index")
+			return
+		}
+	}
+	tasks, records, matched, err := taskManager.Search(strings.Join(words, " "))
+	if err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+	if len(tasks) == 0 && matched == 0 {
+		todo.LogError("Nothing found")
+		os.Exit(1)
+	}
+	for _, result := range tasks {
+		fmt.Println(result.String())
+	}
+	if len(tasks) != 0 && len(records) != 0 {
+		fmt.Println()
+	}
+	for _, result := range records {
+		fmt.Println(result.String())
+	}
+	if matched > len(records) {
+		fmt.Printf("... and %d more matches in the audit log\n", matched-len(records))
+	}
+}
+
+// todo -V
+func graph(storage string, args []string) {
+	if len(args) != 0 {
+		fmt.Printf("%s", HELP_MESSAGE)
+		os.Exit(1)
+	}
+	taskManager := openTaskManager(storage)
+	tasks, err := taskManager.GetTasks()
+	if err != nil {
+		todo.LogError(err.Error())
+		if !todo.IsCorrupt(err) {
+			os.Exit(1)
+		}
+	}
+	fmt.Print(tasks.DependencyGraph())
+}
+
+// todo [-f] -U
+func purge(storage string, args []string, force bool) {
+	if len(args) != 0 {
+		fmt.Printf("%s", HELP_MESSAGE)
+		os.Exit(1)
+	}
+	config := loadConfig()
+	cmdManager, taskManager, tasks := overdueTasks(storage)
+	purges := cmdManager.PlanPurge(tasks, config.Purge)
+	if len(purges) == 0 {
+		todo.LogSuccess("Nothing to purge")
+		return
+	}
+	for _, purge := range purges {
+		fmt.Println(purge.String())
+	}
+	if !force {
+		return
+	}
+	if err := cmdManager.Purge(&taskManager, purges); err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+	todo.LogSuccess(fmt.Sprintf("Purged %d tasks", len(purges)))
+}
+
+// A -E or -M to make once every flag has been read, since the changes can
+// come from flags after it.
+type edit struct {
+	index   string
+	changes todo.TaskChanges
+}
+
+func runEdit(taskManager *todo.TaskManager, cmdManager *todo.CommandManager,
+	pendingEdit edit) (*todo.Task, error) {
+	if pendingEdit.changes.Empty() {
+		tasks, err := taskManager.GetTasks()
+		if err != nil && !todo.IsCorrupt(err) {
+			return nil, err
+		}
+		task, err := tasks.Find(pendingEdit.index)
+		if err != nil {
+			return nil, err
+		}
+		text, err := editInEditor(task.Text())
+		if err != nil {
+			return nil, err
+		}
+		body, description := todo.SplitTaskText(text)
+		pendingEdit.changes.BodyContent = &body
+		pendingEdit.changes.Description = &description
+	}
+	return cmdManager.EditTask(taskManager, pendingEdit.index, pendingEdit.changes)
+}
+
+// Opens text in $EDITOR (vi if it's not set) and returns what was saved.
+func editInEditor(text string) (string, error) {
+	file, err := ioutil.TempFile("", "todo-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(text + "\n")
+	file.Close()
+	if err != nil {
+		return "", err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command("sh", "-c", editor+" \"$1\"", "sh", file.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %v", editor, err)
+	}
+	edited, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(edited), nil
 }
 
 // Read a task in from a reader and pass it off to add_task.
 func readInTask(reader *bufio.Reader) string {
 	bytes, err := ioutil.ReadAll(reader)
 	if err != nil {
-		panic(err)
+		todo.LogError(err.Error())
+		os.Exit(1)
 	}
 	text := string(bytes)
 	return text
 }
 
 func execute_flag_commands(taskManager *todo.TaskManager,
-	cmdManager *todo.CommandManager, opts []getopt.Option) bool {
+	cmdManager *todo.CommandManager, opts []getopt.Option, pendingEdit *edit) bool {
 	instantDelete := false
 
 	for _, opt := range opts {
@@ -118,18 +552,21 @@ func execute_flag_commands(taskManager *todo.TaskManager,
 			fmt.Printf("%s", HELP_MESSAGE)
 			os.Exit(0)
 		case 't':
-			zone, _ := time.Now().Zone()
-			dueDate, err := time.Parse(todo.EXPLICIT_TIME_FORMAT,
-				fmt.Sprintf("%v %s", opt.Value, zone))
-			if err == nil {
-				cmdManager.SetDueDate(dueDate)
-			} else {
-				err = cmdManager.SetDueDateRelative(opt.Value)
-				if err != nil {
-					todo.LogError(err.Error())
-					os.Exit(1)
-				}
+			err := cmdManager.SetDueDateRelative(opt.Value)
+			if err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			dueDate := cmdManager.DueDate
+			pendingEdit.changes.DueDate = &dueDate
+			pendingEdit.changes.HasDueTime = cmdManager.HasDueTime
+		case 'b':
+			if err := cmdManager.AddReminder(opt.Value); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
 			}
+			reminders := cmdManager.Reminders
+			pendingEdit.changes.Reminders = &reminders
 		case 'l':
 			tasks, err := cmdManager.GetTasks(taskManager)
 			if err != nil {
@@ -147,7 +584,7 @@ func execute_flag_commands(taskManager *todo.TaskManager,
 				os.Exit(1)
 			}
 			if !isatty.IsTerminal(os.Stdout.Fd()) {
-				fmt.Printf(taskDeleted.BodyContent)
+				fmt.Print(taskDeleted.Text())
 			}
 		case 'd':
 			if opt.Value == "this" {
@@ -160,7 +597,7 @@ func execute_flag_commands(taskManager *todo.TaskManager,
 				os.Exit(1)
 			}
 			if !isatty.IsTerminal(os.Stdout.Fd()) {
-				fmt.Printf(taskDeleted.BodyContent)
+				fmt.Print(taskDeleted.Text())
 			} else {
 				todo.LogSuccess(taskDeleted.String())
 			}
@@ -171,16 +608,85 @@ func execute_flag_commands(taskManager *todo.TaskManager,
 				os.Exit(1)
 			}
 		case 'r':
-			days, err := strconv.ParseInt(opt.Value, 10, 32)
+			repeat := opt.Value
+			if repeat == "0" {
+				noRepeat := ""
+				pendingEdit.changes.Repeat = &noRepeat
+				continue
+			}
+			if err := cmdManager.SetRepeat(repeat); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			pendingEdit.changes.Repeat = &repeat
+		case 'P':
+			if err := cmdManager.SetPriority(opt.Value); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			priority := cmdManager.Priority
+			pendingEdit.changes.Priority = &priority
+		case 'p':
+			if err := cmdManager.SetMinPriority(opt.Value); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+		case 'T':
+			if err := cmdManager.AddTag(opt.Value); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			tags := cmdManager.Tags
+			pendingEdit.changes.Tags = &tags
+		case 'F':
+			if err := cmdManager.AddTagFilter(opt.Value); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+		case 'q':
+			if err := cmdManager.AddQuery(opt.Value); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+		case 'i':
+			if err := cmdManager.AddItem(opt.Value); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			var items []string
+			for _, item := range cmdManager.Checklist {
+				items = append(items, item.Body)
+			}
+			pendingEdit.changes.AddItems = &items
+		case 'm':
+			cmdManager.SetDescription(opt.Value)
+			description := cmdManager.Description
+			pendingEdit.changes.Description = &description
+		case 'B':
+			if err := cmdManager.AddBlocker(taskManager, opt.Value); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			blockedBy := cmdManager.BlockedBy
+			pendingEdit.changes.BlockedBy = &blockedBy
+		case 'k':
+			task, completed, err := cmdManager.CheckItem(taskManager, opt.Value)
 			if err != nil {
-				err = cmdManager.SetRepeatHumany(opt.Value)
-			} else {
-				err = cmdManager.SetRepeat(int(days))
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			todo.LogSuccess(task.String())
+			if completed {
+				todo.LogSuccess(fmt.Sprintf("Completed \"%s\"", task.BodyContent))
 			}
+		case 'R':
+			anchor, err := todo.ParseRepeatAnchor(opt.Value)
 			if err != nil {
 				todo.LogError(err.Error())
 				os.Exit(1)
 			}
+			cmdManager.RepeatFrom = anchor
+			pendingEdit.changes.RepeatFrom = &anchor
 		case 'x':
 			err := cmdManager.DelayTask(taskManager, opt.Value)
 			if err != nil {
@@ -188,22 +694,54 @@ func execute_flag_commands(taskManager *todo.TaskManager,
 				os.Exit(1)
 			}
 		case 'S':
-			taskManager.StorageDirectory = opt.Value
+			category := taskManager.Category
+			*taskManager = openTaskManager(opt.Value)
+			taskManager.Category = category
 		case 'c':
-			category := opt.Value
-			categoryPath := path.Join(taskManager.StorageDirectory, category)
-			if _, err := os.Stat(categoryPath); os.IsNotExist(err) {
+			category, err := todo.CleanCategory(opt.Value)
+			if err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			exists, err := taskManager.CategoryExists(category)
+			if err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			if !exists {
 				todo.LogError(fmt.Sprintf("Category \"%s\" does not exist", category))
 				os.Exit(1)
 			}
-			fallthrough
+			taskManager.Category = category
 		case 'C':
-			taskManager.StorageDirectory = path.Join(taskManager.StorageDirectory, opt.Value)
+			category, err := todo.CleanCategory(opt.Value)
+			if err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			if err := taskManager.CreateCategory(category); err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			taskManager.Category = category
 		case 'L':
-			categories := cmdManager.GetCategories(taskManager)
+			categories, err := cmdManager.GetCategories(taskManager)
+			if err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
 			for _, category := range categories {
 				fmt.Println(category)
 			}
+		case 'G':
+			tags, err := cmdManager.GetTags(taskManager)
+			if err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
+			for _, tag := range tags {
+				fmt.Println(tag)
+			}
 		case 'n':
 			days, err := strconv.ParseInt(opt.Value, 10, 32)
 			if err != nil {
@@ -211,23 +749,43 @@ func execute_flag_commands(taskManager *todo.TaskManager,
 				os.Exit(1)
 			}
 
-			err = cmdManager.SetDelay(int(days))
+			overdueDays := int(days)
+			pendingEdit.changes.OverdueDays = &overdueDays
+			if days == 0 {
+				continue
+			}
+			err = cmdManager.SetDelay(overdueDays)
 			if err != nil {
 				todo.LogError(err.Error())
 				os.Exit(1)
 			}
 		case 'A':
-			records := cmdManager.GetAuditLog(taskManager)
+			records, err := cmdManager.GetAuditLog(taskManager)
+			if err != nil {
+				todo.LogError(err.Error())
+				os.Exit(1)
+			}
 			for _, record := range records {
 				fmt.Println(record.String())
 			}
 		case 'e':
 			cmdManager.Annotation = opt.Value
+		case 'E':
+			pendingEdit.index = opt.Value
+			cmdManager.SkipTaskCreationPrompt = true
+		case 'M':
+			category := opt.Value
+			pendingEdit.changes.Category = &category
+			cmdManager.SkipTaskCreationPrompt = true
 		}
 
 	}
 
-	tasksAll := cmdManager.GetTasksIfAll(taskManager)
+	tasksAll, err := cmdManager.GetTasksIfAll(taskManager)
+	if err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
 	todo.DisplayTasksLong(tasksAll)
 
 	return instantDelete
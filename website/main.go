@@ -5,20 +5,31 @@ import (
 	"fmt"
 	"git.sr.ht/~sircmpwn/getopt"
 	"git.sr.ht/~timidger/todo"
+	"github.com/mattn/go-isatty"
 	"html/template"
 	"net/http"
 	"os"
-	"path"
 	"strconv"
 	"strings"
-	"time"
 )
 
 const HELP_MESSAGE = "Usage of website:\n" +
 	"  -p              Set the port number\n"
 const WEBPAGE = "todo.html"
 
+// Opened once, the same way the todo command opens them.
+var (
+	storage string
+	store   todo.Store
+	clock   todo.Clock
+)
+
 func main() {
+	// Pages are HTML, only the log can be a terminal
+	todo.SetDisplay(todo.Display{
+		LogColors: os.Getenv("NO_COLOR") == "" && isatty.IsTerminal(os.Stderr.Fd()),
+		Theme:     todo.DEFAULT_THEME,
+	})
 	opts, _, err := getopt.Getopts(os.Args, "p:")
 	if err != nil {
 		fmt.Printf("%s", HELP_MESSAGE)
@@ -38,6 +49,18 @@ func main() {
 		}
 	}
 
+	storage = todo.DefaultStorage()
+	store, err = todo.OpenStore(storage)
+	if err != nil {
+		todo.LogError(fmt.Sprintf("Could not open \"%s\": %v", storage, err))
+		os.Exit(1)
+	}
+	clock, err = todo.EnvClock()
+	if err != nil {
+		todo.LogError(err.Error())
+		os.Exit(1)
+	}
+
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
 	http.HandleFunc("/", rootHandler)
 
@@ -48,15 +71,18 @@ func main() {
 type Result struct {
 	Categories todo.Categories
 	Tasks      todo.Tasks
+	Query      string
 }
 
 func rootHandler(w http.ResponseWriter, req *http.Request) {
-	todo.ClearCache()
 	var task_manager todo.TaskManager
 	var cmd_manager todo.CommandManager
 
-	task_manager.StorageDirectory = path.Join(os.Getenv("HOME"), ".todo/")
-	cmd_manager.DueDate = time.Now()
+	task_manager.StorageDirectory = storage
+	task_manager.Store = store
+	task_manager.Clock = clock
+	cmd_manager.Clock = clock
+	cmd_manager.DueDate = clock.Now()
 	cmd_manager.Listing = todo.LISTING_DAY
 
 	// The "/" pattern matches everything, so we need to check
@@ -80,9 +106,20 @@ func rootHandler(w http.ResponseWriter, req *http.Request) {
 		}
 		category := strings.TrimSpace(req.FormValue("category"))
 		task_body := strings.TrimSpace(req.FormValue("task_body"))
+		due := strings.TrimSpace(req.FormValue("due"))
+		if due != "" {
+			if err := cmd_manager.SetDueDateRelative(due); err != nil {
+				fmt.Fprintf(w, "%v\n", err)
+				return
+			}
+		}
+		if err := cmd_manager.SetPriority(req.FormValue("priority")); err != nil {
+			fmt.Fprintf(w, "%v\n", err)
+			return
+		}
 		err := create_task(&task_manager, &cmd_manager, category, task_body)
 		if err != nil {
-			fmt.Fprintf(w, "%v\n", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		// XXX Yes we are assuming we are at /todo here, which is handled by nginx
@@ -99,29 +136,56 @@ func rootHandler(w http.ResponseWriter, req *http.Request) {
 
 		templ, err := templ.ParseFiles(WEBPAGE)
 		if err != nil {
-			panic(err)
+			server_error(w, err)
+			return
+		}
+		// e.g. /todo?priority=B for only the more important tasks
+		if err := cmd_manager.SetMinPriority(req.URL.Query().Get("priority")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// e.g. /todo?q=category:work+overdue, see todo.Query
+		if query := strings.TrimSpace(req.URL.Query().Get("q")); query != "" {
+			if err := cmd_manager.AddQuery(query); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
 
 		tasks, err := cmd_manager.GetTasks(&task_manager)
 		if err != nil {
-			panic(err)
+			server_error(w, err)
+			return
+		}
+		categories, err := task_manager.GetCategories()
+		if err != nil {
+			server_error(w, err)
+			return
 		}
 		result := Result{
-			Categories: task_manager.GetCategories(),
-			Tasks:      tasks}
+			Categories: categories,
+			Tasks:      tasks,
+			Query:      req.URL.Query().Get("q")}
 		err = templ.Execute(w, result)
 		if err != nil {
-			panic(err)
+			todo.LogError(err.Error())
 		}
 	}
 }
 
+func server_error(w http.ResponseWriter, err error) {
+	todo.LogError(err.Error())
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
 func create_task(task_manager *todo.TaskManager, cmd_manager *todo.CommandManager,
 	category, task_body string) error {
 
-	original := task_manager.StorageDirectory
+	original := task_manager.Category
 	defer reset_category(task_manager, original)
-	set_category(task_manager, category)
+	if err := set_category(task_manager, category); err != nil {
+		return err
+	}
 
 	_, err := cmd_manager.CreateTask(task_manager, task_body)
 	if err != nil {
@@ -140,20 +204,26 @@ func delete_task(task_manager *todo.TaskManager, cmd_manager *todo.CommandManage
 }
 
 func set_category(task_manager *todo.TaskManager, category string) error {
+	category, err := todo.CleanCategory(category)
+	if err != nil {
+		return err
+	}
 	if category != "" {
-		category_path := path.Join(task_manager.StorageDirectory, category)
-		if _, err := os.Stat(category_path); os.IsNotExist(err) {
+		exists, err := task_manager.CategoryExists(category)
+		if err != nil {
+			todo.LogError(err.Error())
+			return err
+		}
+		if !exists {
 			msg := fmt.Sprintf("Category \"%s\" does not exist", category)
 			todo.LogError(msg)
 			return errors.New(msg)
 		}
-		task_manager.StorageDirectory = path.Join(
-			task_manager.StorageDirectory,
-			category)
+		task_manager.Category = category
 	}
 	return nil
 }
 
 func reset_category(task_manager *todo.TaskManager, original string) {
-	task_manager.StorageDirectory = original
+	task_manager.Category = original
 }
@@ -0,0 +1,57 @@
+package todo
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// How dates are written in the audit log: a calendar date, or date and
+// time, followed by the IANA name of the zone it's in.
+const RECORD_DATE_FORMAT = "2006/01/02"
+const RECORD_DATE_TIME_FORMAT = "2006/01/02 15:04:05"
+
+// The IANA name of a location, e.g. "Europe/Berlin". time.Local is called
+// "Local", so its real name is looked up from $TZ or /etc/localtime.
+func zoneName(location *time.Location) string {
+	if location != time.Local {
+		return location.String()
+	}
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if i := strings.Index(target, "zoneinfo/"); i != -1 {
+			return target[i+len("zoneinfo/"):]
+		}
+	}
+	// Loads as time.Local, which is the best that can be done
+	return location.String()
+}
+
+// Midnight at the start of a day, in the day's own zone.
+func startOfDay(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+}
+
+// Writes a date in the audit log, e.g. "2026/03/01 Europe/Berlin".
+func formatRecordDate(date time.Time, layout string) string {
+	return date.Format(layout) + " " + zoneName(date.Location())
+}
+
+// Reads a date from the audit log. Logs used to have zone abbreviations,
+// e.g. "2026/03/01 CET", which still read but, as abbreviations are
+// ambiguous, may be in the wrong zone.
+func parseRecordDate(text, layout, oldLayout string) (time.Time, error) {
+	if i := strings.LastIndex(text, " "); i != -1 {
+		if location, err := time.LoadLocation(text[i+1:]); err == nil {
+			date, err := time.ParseInLocation(layout, text[:i], location)
+			if err == nil {
+				return date, nil
+			}
+		}
+	}
+	return time.Parse(oldLayout, text)
+}
@@ -0,0 +1,69 @@
+package todo
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func loadTestLocation(t *testing.T, name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no zone info for %s: %v", name, err)
+	}
+	return location
+}
+
+func TestRecordDateRoundTrip(t *testing.T) {
+	berlin := loadTestLocation(t, "Europe/Berlin")
+	for _, date := range []time.Time{
+		// Either side of the clocks going back
+		time.Date(2026, 10, 24, 0, 0, 0, 0, berlin),
+		time.Date(2026, 10, 26, 0, 0, 0, 0, berlin),
+		time.Date(2026, 10, 25, 2, 30, 0, 0, time.UTC),
+	} {
+		text := formatRecordDate(date, RECORD_DATE_TIME_FORMAT)
+		got, err := parseRecordDate(text, RECORD_DATE_TIME_FORMAT, RECORD_TIME_FORMAT)
+		if err != nil {
+			t.Errorf("parseRecordDate(%q): %v", text, err)
+		} else if !got.Equal(date) || got.Location().String() != date.Location().String() {
+			t.Errorf("parseRecordDate(%q) = %v, want %v", text, got, date)
+		}
+	}
+	// Older logs only have an abbreviation
+	if got, err := parseRecordDate("2026/03/01 UTC", RECORD_DATE_FORMAT, EXPLICIT_TIME_FORMAT); err != nil ||
+		!got.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseRecordDate of an old date = %v, %v", got, err)
+	}
+}
+
+// A task due at midnight stays due at midnight in its zone, whatever the
+// offset was when it was saved.
+func TestDueDateAcrossDaylightSaving(t *testing.T) {
+	london := loadTestLocation(t, "Europe/London")
+	task := testTask(t, "water plants", "")
+	task.setDueDate(time.Date(2026, 10, 24, 0, 0, 0, 0, london))
+	task.Repeat = &Recurrence{Frequency: DAILY}
+	next, err := task.NextDueDate(task.DueDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 10, 25, 0, 0, 0, 0, london); !next.Equal(want) {
+		t.Errorf("next due %v, want %v", next, want)
+	}
+
+	task.setDueDate(next.AddDate(0, 0, 1))
+	data, err := json.Marshal(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Task
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	// Read back in the zone, not at the offset it was written with
+	if read.Zone != "Europe/London" || read.DueDate.Location().String() != "Europe/London" ||
+		read.DueDate.Hour() != 0 || read.DueDate.Day() != 26 {
+		t.Errorf("read back due %v in %q, want midnight on the 26th in Europe/London", read.DueDate, read.Zone)
+	}
+}